@@ -0,0 +1,102 @@
+package email
+
+import (
+	"context"
+	"log"
+	"net/mail"
+	"strings"
+	"time"
+
+	"portfolio-back/config"
+	"portfolio-back/store"
+	"portfolio-back/transport"
+)
+
+// acknowledgements thank the visitors who left their email address, with a copy of their message.
+// Each address is acknowledged at most once per ACKNOWLEDGEMENT_INTERVAL,
+// so that the form cannot be abused to flood third parties.
+type acknowledgements struct {
+	subject   string
+	from      string
+	replyTo   *mail.Address
+	templates *emailTemplates
+	throttle  store.Store
+	interval  time.Duration
+}
+
+// loadAcknowledgements returns nil if ACKNOWLEDGEMENT_SUBJECT is not set, which disables acknowledgements.
+func loadAcknowledgements(getEnv func(string) string) (*acknowledgements, error) {
+	subject := getEnv("ACKNOWLEDGEMENT_SUBJECT")
+	if subject == "" {
+		return nil, nil
+	}
+	templates, err := loadTemplates(getEnv, acknowledgementTemplateName)
+	if err != nil {
+		return nil, err
+	}
+	throttle, err := store.New(getEnv, "ACKNOWLEDGEMENT")
+	if err != nil {
+		return nil, err
+	}
+	return &acknowledgements{
+		subject:   subject,
+		from:      getEnv("SOURCE_EMAIL_ADDRESS"),
+		replyTo:   &mail.Address{Address: getEnv("TARGET_EMAIL_ADDRESS")},
+		templates: templates,
+		throttle:  throttle,
+		interval:  config.Milliseconds(getEnv, "ACKNOWLEDGEMENT_INTERVAL", time.Hour),
+	}, nil
+}
+
+// send acknowledges the email if it has a reply address, and returns the outcome,
+// which is reported apart from the delivery of the email itself.
+func (acks *acknowledgements) send(ctx context.Context, mailTransport transport.Transport, email *requestBody, receivedAt time.Time) string {
+	visitor := replyToAddress(email)
+	if acks == nil || visitor == nil {
+		return ""
+	}
+	allowed, err := acks.claim(visitor.Address)
+	if err != nil {
+		// Failing closed, as an unchecked address could be flooded.
+		log.Printf("[ERROR] Failed to throttle acknowledgement to %s: %s\n", visitor.Address, err)
+		return "failed"
+	}
+	if !allowed {
+		log.Printf("[WARN] Throttled acknowledgement to %s\n", visitor.Address)
+		return "throttled"
+	}
+
+	message := transport.NewMessage(acks.from, []string{visitor.Address}, acks.subject, "")
+	message.ReplyTo = acks.replyTo
+	message.Html, message.Text, err = acks.templates.render(&templateData{
+		Sender:      email.Sender,
+		SenderEmail: email.SenderEmail,
+		Subject:     email.Subject,
+		Body:        email.Body,
+		ReceivedAt:  receivedAt,
+	})
+	if err == nil {
+		err = mailTransport.Send(ctx, message)
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to acknowledge email to %s: %s\n", visitor.Address, err)
+		return "failed"
+	}
+	if transport.IsQueued(mailTransport) {
+		return "queued"
+	}
+	return "sent"
+}
+
+// claim reports whether the address may be acknowledged, in which case it is throttled for the next interval.
+func (acks *acknowledgements) claim(address string) (bool, error) {
+	allowed := false
+	err := acks.throttle.Update("address:"+strings.ToLower(address), func(entry *store.Entry) *store.Entry {
+		if entry != nil {
+			return entry
+		}
+		allowed = true
+		return &store.Entry{ExpiresAt: time.Now().Add(acks.interval)}
+	})
+	return allowed, err
+}
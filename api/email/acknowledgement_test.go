@@ -0,0 +1,105 @@
+package email
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const acknowledgementSubject = "Thanks for your message"
+
+var acknowledgementEnv = map[string]string{"ACKNOWLEDGEMENT_SUBJECT": acknowledgementSubject}
+
+func TestSendAcknowledgement(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	handlePostEmail := newTestHandler(t, mailTransport, acknowledgementEnv)
+
+	response := postJson(t, handlePostEmail, newTestEmailFrom("Jane Doe <Jane@Test.com>", emailBody), acceptJson)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	body := decodeSuccessBody(t, response)
+	assert.Equal(t, "sent", body.Status)
+	assert.Equal(t, "sent", body.Acknowledgement)
+	require.Len(t, mailTransport.messages, 2)
+	acknowledgement := mailTransport.messages[1]
+	assert.Equal(t, []string{"Jane@Test.com"}, acknowledgement.To)
+	assert.Equal(t, sourceEmailAddress, acknowledgement.From)
+	assert.Equal(t, targetEmailAddress, acknowledgement.ReplyTo.Address)
+	assert.Equal(t, acknowledgementSubject, acknowledgement.Subject)
+	assert.Contains(t, acknowledgement.Text, "Hello "+emailSender)
+	assert.Contains(t, acknowledgement.Text, emailBody)
+	assert.Contains(t, acknowledgement.Html, emailBody)
+}
+
+func TestThrottleAcknowledgements(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	handlePostEmail := newTestHandler(t, mailTransport, acknowledgementEnv)
+
+	first := decodeSuccessBody(t, postJson(t, handlePostEmail, newTestEmailFrom("jane@test.com", "First message"), acceptJson))
+	second := decodeSuccessBody(t, postJson(t, handlePostEmail, newTestEmailFrom("JANE@test.com", "Second message"), acceptJson))
+	other := decodeSuccessBody(t, postJson(t, handlePostEmail, newTestEmailFrom("john@test.com", "Third message"), acceptJson))
+
+	assert.Equal(t, "sent", first.Acknowledgement)
+	assert.Equal(t, "throttled", second.Acknowledgement)
+	assert.Equal(t, "sent", second.Status)
+	assert.Equal(t, "sent", other.Acknowledgement)
+	assert.Len(t, mailTransport.messages, 5)
+}
+
+func TestReportFailedAcknowledgement(t *testing.T) {
+	mailTransport := &fakeTransport{failingRecipient: "jane@test.com"}
+	handlePostEmail := newTestHandler(t, mailTransport, acknowledgementEnv)
+
+	response := postJson(t, handlePostEmail, newTestEmailFrom("jane@test.com", emailBody), acceptJson)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	body := decodeSuccessBody(t, response)
+	assert.Equal(t, "sent", body.Status)
+	assert.Equal(t, "failed", body.Acknowledgement)
+	assert.Len(t, mailTransport.messages, 1)
+}
+
+func TestSkipAcknowledgement(t *testing.T) {
+	for name, testCase := range map[string]struct {
+		env         map[string]string
+		senderEmail string
+		body        string
+	}{
+		"disabled":         {env: nil, senderEmail: "jane@test.com", body: emailBody},
+		"no reply address": {env: acknowledgementEnv, senderEmail: "", body: emailBody},
+		"suspected of spam": {
+			env:         map[string]string{"ACKNOWLEDGEMENT_SUBJECT": acknowledgementSubject, "SPAM_KEYWORDS": "casino", "SPAM_KEYWORDS_SCORE": "5"},
+			senderEmail: "jane@test.com",
+			body:        "Visit my casino",
+		},
+	} {
+		mailTransport := &fakeTransport{}
+		handlePostEmail := newTestHandler(t, mailTransport, testCase.env)
+
+		body := decodeSuccessBody(t, postJson(t, handlePostEmail, newTestEmailFrom(testCase.senderEmail, testCase.body), acceptJson))
+
+		assert.Empty(t, body.Acknowledgement, "Acknowledged email despite %s", name)
+		assert.Len(t, mailTransport.messages, 1, "Unexpected messages despite %s", name)
+	}
+}
+
+func TestAcknowledgementTemplatesFailFast(t *testing.T) {
+	directory := writeTemplates(t, "<p>{{.Body}}</p>", "{{.Body}}")
+	env := newTestEnv(0)
+	env["EMAIL_TEMPLATES_DIRECTORY"] = directory
+	_, err := HandlePostEmail(&fakeTransport{}, nil, nil, mockGetEnv(env))
+	require.Nil(t, err, "Failed to set up email handler: %s\n", err)
+
+	env["ACKNOWLEDGEMENT_SUBJECT"] = acknowledgementSubject
+	_, err = HandlePostEmail(&fakeTransport{}, nil, nil, mockGetEnv(env))
+	assert.NotNil(t, err, "Missing acknowledgement templates were accepted")
+}
+
+func newTestEmailFrom(senderEmail string, body string) *requestBody {
+	email := newTestRequestBody(emailSubject, emailSender)
+	email.SenderEmail = senderEmail
+	email.Body = body
+	return email
+}
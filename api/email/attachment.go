@@ -0,0 +1,137 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"portfolio-back/config"
+	"portfolio-back/transport"
+)
+
+const (
+	attachmentsFieldName = "Attachments"
+	// Bounds the text fields of multipart forms, which are small compared to attachments.
+	maxFormFieldSize = 64 << 10
+	maxFilenameBytes = 255
+)
+
+type attachmentLimits struct {
+	maxCount     int
+	maxSize      int64
+	maxTotalSize int64
+	allowedTypes []string
+}
+
+func loadAttachmentLimits(getEnv func(string) string) *attachmentLimits {
+	allowedTypes := config.List(getEnv, "EMAIL_ATTACHMENT_TYPES")
+	if len(allowedTypes) == 0 {
+		allowedTypes = []string{"application/pdf", "image/gif", "image/jpeg", "image/png", "text/plain"}
+	}
+	return &attachmentLimits{
+		maxCount:     max(0, config.Int(getEnv, "EMAIL_ATTACHMENTS_MAX_COUNT", 5)),
+		maxSize:      int64(max(0, config.Int(getEnv, "EMAIL_ATTACHMENT_MAX_SIZE", 5<<20))),
+		maxTotalSize: int64(max(0, config.Int(getEnv, "EMAIL_ATTACHMENTS_MAX_TOTAL_SIZE", 10<<20))),
+		allowedTypes: allowedTypes,
+	}
+}
+
+// decodeMultipartForm streams the form, so that oversized files are rejected without being buffered.
+// The content type of files is sniffed rather than trusted from the client.
+func decodeMultipartForm(request *http.Request, limits *attachmentLimits) (*requestBody, []*transport.Attachment, *requestError) {
+	request.Body = http.MaxBytesReader(nil, request.Body, limits.maxTotalSize+maxTextRequestSize)
+	reader, err := request.MultipartReader()
+	if err != nil {
+		return nil, nil, newRequestError(http.StatusBadRequest, "", "malformed_body", "must be a valid multipart form")
+	}
+
+	email := &requestBody{}
+	var attachments []*transport.Attachment
+	var totalSize int64
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return email, attachments, nil
+		}
+		if err != nil {
+			return nil, nil, multipartReadError(err)
+		}
+
+		if part.FileName() == "" {
+			value, err := io.ReadAll(io.LimitReader(part, maxFormFieldSize+1))
+			if err != nil {
+				return nil, nil, multipartReadError(err)
+			}
+			if len(value) > maxFormFieldSize {
+				return nil, nil, newRequestError(http.StatusRequestEntityTooLarge, part.FormName(), "too_long", fmt.Sprintf("must not exceed %d bytes", maxFormFieldSize))
+			}
+			// Browsers send file inputs left empty as parts without file name nor content.
+			if part.FormName() == attachmentsFieldName && len(value) == 0 {
+				continue
+			}
+			if !setFormField(email, part.FormName(), string(value)) {
+				return nil, nil, newRequestError(http.StatusBadRequest, part.FormName(), "unknown_field", "is not allowed")
+			}
+			continue
+		}
+
+		if part.FormName() != attachmentsFieldName {
+			return nil, nil, newRequestError(http.StatusBadRequest, part.FormName(), "unexpected_file", "must not be a file")
+		}
+		if len(attachments) >= limits.maxCount {
+			return nil, nil, newRequestError(http.StatusRequestEntityTooLarge, attachmentsFieldName, "too_many_files", fmt.Sprintf("must not exceed %d files", limits.maxCount))
+		}
+		content, err := io.ReadAll(io.LimitReader(part, limits.maxSize+1))
+		if err != nil {
+			return nil, nil, multipartReadError(err)
+		}
+		filename := sanitizeFilename(part.FileName())
+		if int64(len(content)) > limits.maxSize {
+			return nil, nil, newRequestError(http.StatusRequestEntityTooLarge, attachmentsFieldName, "file_too_large", fmt.Sprintf("%s must not exceed %d bytes", filename, limits.maxSize))
+		}
+		totalSize += int64(len(content))
+		if totalSize > limits.maxTotalSize {
+			return nil, nil, newRequestError(http.StatusRequestEntityTooLarge, attachmentsFieldName, "attachments_too_large", fmt.Sprintf("must not exceed %d bytes in total", limits.maxTotalSize))
+		}
+		contentType, _, _ := mime.ParseMediaType(http.DetectContentType(content))
+		if !slices.Contains(limits.allowedTypes, contentType) {
+			log.Printf("[WARN] Rejected attachment %q of type %s\n", filename, contentType)
+			return nil, nil, newRequestError(http.StatusBadRequest, attachmentsFieldName, "file_type_not_allowed", fmt.Sprintf("%s must be one of %s", filename, strings.Join(limits.allowedTypes, ", ")))
+		}
+		attachments = append(attachments, &transport.Attachment{Filename: filename, ContentType: contentType, Content: content})
+	}
+}
+
+func multipartReadError(err error) *requestError {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		return bodyTooLargeError(maxBytesError)
+	}
+	return newRequestError(http.StatusBadRequest, "", "malformed_body", "must be a valid multipart form")
+}
+
+// sanitizeFilename keeps the file name safe to put in MIME headers and to open on the recipient's machine.
+func sanitizeFilename(filename string) string {
+	filename = strings.ToValidUTF8(filename, "")
+	filename = strings.Map(func(char rune) rune {
+		if isForbiddenInHeader(char) || strings.ContainsRune(`/\:*?"<>|`, char) {
+			return '_'
+		}
+		return char
+	}, filename)
+	filename = strings.TrimSpace(filename)
+	for len(filename) > maxFilenameBytes {
+		_, lastRuneSize := utf8.DecodeLastRuneInString(filename)
+		filename = filename[:len(filename)-lastRuneSize]
+	}
+	if filename == "" || filename == "." || filename == ".." {
+		return "attachment"
+	}
+	return filename
+}
@@ -0,0 +1,203 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/mail"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var pdfContent = []byte("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n1 0 obj << /Type /Catalog >> endobj\n")
+var pngContent = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01")
+
+type testFile struct {
+	fieldName string
+	filename  string
+	content   []byte
+}
+
+func TestSendAttachments(t *testing.T) {
+	emailsReceived := 0
+	smtpHandler := func(_ net.Addr, _ string, _ []string, data []byte) error {
+		emailsReceived++
+		message, err := mail.ReadMessage(bytes.NewReader(data))
+		require.Nil(t, err, "Failed to parse email: %s\n", err)
+		mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+		require.Nil(t, err, "Failed to parse email content type: %s\n", err)
+		require.Equal(t, "multipart/mixed", mediaType)
+
+		reader := multipart.NewReader(message.Body, params["boundary"])
+		body, err := reader.NextPart()
+		require.Nil(t, err, "Failed to read email body: %s\n", err)
+		parts := readAlternativeParts(t, &mail.Message{Header: mail.Header(body.Header), Body: body})
+		assert.Contains(t, parts["text/plain"], "Attachments: job description.pdf, logo.png")
+
+		for _, expected := range []struct {
+			filename    string
+			contentType string
+			content     []byte
+		}{
+			{"job description.pdf", "application/pdf", pdfContent},
+			{"logo.png", "image/png", pngContent},
+		} {
+			part, err := reader.NextPart()
+			require.Nil(t, err, "Failed to read attachment: %s\n", err)
+			assert.Equal(t, expected.filename, part.FileName())
+			assert.Equal(t, expected.contentType, strings.Split(part.Header.Get("Content-Type"), ";")[0])
+			content, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+			require.Nil(t, err, "Failed to decode attachment: %s\n", err)
+			assert.Equal(t, expected.content, content)
+		}
+		_, err = reader.NextPart()
+		assert.Equal(t, io.EOF, err)
+		return nil
+	}
+
+	smtpServer, smtpServerPort := setupSmtpServer(t, smtpHandler, nil)
+	defer teardownSmtpServer(smtpServer)
+	testHttpServer, shutdownWaitGroup, triggerShutdown := setupHttpServer(context.Background(), smtpServerPort)
+	defer teardownHttpServer(testHttpServer, shutdownWaitGroup, triggerShutdown)
+
+	body, contentType := newMultipartBody(t, newTestFormFields(), []testFile{
+		{attachmentsFieldName, "job description.pdf", pdfContent},
+		{attachmentsFieldName, "logo.png", pngContent},
+	})
+	response, err := newHttpClientNoRedirects().Post(testHttpServer.URL, contentType, strings.NewReader(body))
+	require.Nil(t, err, "Failed to POST email: %s\n", err)
+	assert.Equal(t, http.StatusFound, response.StatusCode)
+	assert.Equal(t, successRedirectUrl, response.Header.Get("Location"))
+	assert.Equal(t, 1, emailsReceived)
+}
+
+func TestMapFormFieldsWithoutAttachments(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	fields := newTestFormFields()
+	fields["SenderEmail"] = "jane@test.com"
+	body, contentType := newMultipartBody(t, fields, nil)
+	response := post(newTestHandler(t, mailTransport, nil), contentType, body, nil)
+
+	require.Equal(t, http.StatusFound, response.Code)
+	assert.Equal(t, successRedirectUrl, response.Header().Get("Location"))
+	assert.Equal(t, emailSubject, mailTransport.lastMessage().Subject)
+	assert.Equal(t, "jane@test.com", mailTransport.lastMessage().ReplyTo.Address)
+	assert.Empty(t, mailTransport.lastMessage().Attachments)
+}
+
+func TestIgnoreEmptyFileInputs(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	body, contentType := newMultipartBody(t, newTestFormFields(), []testFile{{attachmentsFieldName, "", nil}})
+	response := post(newTestHandler(t, mailTransport, nil), contentType, body, nil)
+
+	require.Equal(t, http.StatusFound, response.Code)
+	assert.Equal(t, successRedirectUrl, response.Header().Get("Location"))
+	assert.Empty(t, mailTransport.lastMessage().Attachments)
+}
+
+func TestRejectInvalidAttachments(t *testing.T) {
+	for name, testCase := range map[string]struct {
+		env            map[string]string
+		files          []testFile
+		expectedStatus int
+	}{
+		"file too large": {
+			env:            map[string]string{"EMAIL_ATTACHMENT_MAX_SIZE": "10"},
+			files:          []testFile{{attachmentsFieldName, "job.pdf", pdfContent}},
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		"too many files": {
+			env:            map[string]string{"EMAIL_ATTACHMENTS_MAX_COUNT": "1"},
+			files:          []testFile{{attachmentsFieldName, "job.pdf", pdfContent}, {attachmentsFieldName, "logo.png", pngContent}},
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		"total too large": {
+			env:            map[string]string{"EMAIL_ATTACHMENTS_MAX_TOTAL_SIZE": "70"},
+			files:          []testFile{{attachmentsFieldName, "job.pdf", pdfContent}, {attachmentsFieldName, "logo.png", pngContent}},
+			expectedStatus: http.StatusRequestEntityTooLarge,
+		},
+		"disallowed type": {
+			files:          []testFile{{attachmentsFieldName, "setup.exe", []byte("MZ\x90\x00\x03\x00\x00\x00")}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		"spoofed type": {
+			files:          []testFile{{attachmentsFieldName, "job.pdf", []byte("<html><script>alert(1)</script></html>")}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		"type not in custom allowlist": {
+			env:            map[string]string{"EMAIL_ATTACHMENT_TYPES": "application/pdf"},
+			files:          []testFile{{attachmentsFieldName, "logo.png", pngContent}},
+			expectedStatus: http.StatusBadRequest,
+		},
+		"file in text field": {
+			files:          []testFile{{"Body", "job.pdf", pdfContent}},
+			expectedStatus: http.StatusBadRequest,
+		},
+	} {
+		mailTransport := &fakeTransport{}
+		requestBody, contentType := newMultipartBody(t, newTestFormFields(), testCase.files)
+		response := post(newTestHandler(t, mailTransport, testCase.env), contentType, requestBody, acceptJson)
+
+		assert.Equal(t, testCase.expectedStatus, response.Code, "Unexpected status for %s", name)
+		var body problemDetails
+		require.Nil(t, json.NewDecoder(response.Body).Decode(&body))
+		assert.Len(t, body.Errors, 1, "Unexpected errors for %s", name)
+		assert.Nil(t, mailTransport.lastMessage(), "Email was sent despite %s", name)
+	}
+}
+
+func TestRejectMalformedMultipartForm(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	response := post(newTestHandler(t, mailTransport, nil), "multipart/form-data; boundary=missing", "not a multipart body", nil)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Nil(t, mailTransport.lastMessage())
+}
+
+func TestSanitizeFilename(t *testing.T) {
+	for filename, expected := range map[string]string{
+		"job.pdf":                    "job.pdf",
+		"offre d'emploi – café.pdf":  "offre d'emploi – café.pdf",
+		"job\r\nBcc: x@test.com.pdf": "job__Bcc_ x@test.com.pdf",
+		`"quoted" <name>.pdf`:        "_quoted_ _name_.pdf",
+		"  ":                         "attachment",
+		"..":                         "attachment",
+		"invalid \xff.pdf":           "invalid .pdf",
+		strings.Repeat("é", 200):     strings.Repeat("é", 127),
+	} {
+		assert.Equal(t, expected, sanitizeFilename(filename))
+	}
+}
+
+func newMultipartBody(t *testing.T, fields map[string]string, files []testFile) (string, string) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for name, value := range fields {
+		require.Nil(t, writer.WriteField(name, value))
+	}
+	for _, file := range files {
+		fileWriter, err := writer.CreateFormFile(file.fieldName, file.filename)
+		require.Nil(t, err, "Failed to create form file: %s\n", err)
+		fileWriter.Write(file.content)
+	}
+	require.Nil(t, writer.Close())
+	return body.String(), writer.FormDataContentType()
+}
+
+func newTestFormFields() map[string]string {
+	return map[string]string{
+		"Sender":             emailSender,
+		"Subject":            emailSubject,
+		"Body":               emailBody,
+		"SuccessRedirectUrl": successRedirectUrl,
+	}
+}
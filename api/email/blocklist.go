@@ -0,0 +1,22 @@
+package email
+
+import (
+	"net/http"
+
+	"portfolio-back/blocklist"
+)
+
+// newBlocklistSubject describes the submission to the blocklist,
+// whose rules match the bare address of the sender email, without its display name.
+func newBlocklistSubject(request *http.Request, email *requestBody) *blocklist.Subject {
+	subject := &blocklist.Subject{
+		Ip:      request.RemoteAddr,
+		Sender:  email.Sender,
+		Subject: email.Subject,
+		Body:    email.Body,
+	}
+	if replyTo := replyToAddress(email); replyTo != nil {
+		subject.SenderEmail = replyTo.Address
+	}
+	return subject
+}
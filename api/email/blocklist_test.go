@@ -0,0 +1,61 @@
+package email
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"portfolio-back/blocklist"
+)
+
+func TestApplyBlocklist(t *testing.T) {
+	blocklistPath := filepath.Join(t.TempDir(), "blocklist.json")
+	blocklistContent := `{"block": {"domains": ["spam.test"]}, "allow": {"domains": ["friend.test"]}}`
+	require.Nil(t, os.WriteFile(blocklistPath, []byte(blocklistContent), 0o640))
+	senderBlocklist, err := blocklist.New(mockGetEnv(map[string]string{"BLOCKLIST_FILE": blocklistPath}))
+	require.Nil(t, err, "Failed to load blocklist: %s\n", err)
+	env := newTestEnv(0)
+	env["SPAM_KEYWORDS"] = "casino"
+	env["SPAM_KEYWORDS_SCORE"] = "5"
+
+	for senderEmail, expectedSubject := range map[string]string{
+		"jane@spam.test":   "",
+		"jane@friend.test": emailSubject,
+		"jane@other.test":  "[SPAM] " + emailSubject,
+	} {
+		mailTransport := &fakeTransport{}
+		email := newTestRequestBody(emailSubject, emailSender)
+		email.SenderEmail = senderEmail
+		email.Body = "Visit my casino"
+		handlePostEmail, err := HandlePostEmail(mailTransport, nil, senderBlocklist, mockGetEnv(env))
+		require.Nil(t, err, "Failed to set up email handler: %s\n", err)
+		response := postJson(t, handlePostEmail, email, acceptJson)
+
+		assert.Equal(t, http.StatusOK, response.Code, "Unexpected status for %s", senderEmail)
+		if expectedSubject == "" {
+			assert.Nil(t, mailTransport.lastMessage(), "Blocked email was sent for %s", senderEmail)
+		} else if assert.NotNil(t, mailTransport.lastMessage(), "Email was not sent for %s", senderEmail) {
+			assert.Equal(t, expectedSubject, mailTransport.lastMessage().Subject)
+		}
+	}
+}
+
+func TestNewBlocklistSubject(t *testing.T) {
+	email := newTestRequestBody(emailSubject, emailSender)
+	email.SenderEmail = "Jane Doe <jane@test.com>"
+	request := httptest.NewRequest(http.MethodPost, "/api/email", nil)
+	request.RemoteAddr = "203.0.113.42"
+
+	assert.Equal(t, &blocklist.Subject{
+		Ip:          "203.0.113.42",
+		Sender:      emailSender,
+		SenderEmail: "jane@test.com",
+		Subject:     emailSubject,
+		Body:        emailBody,
+	}, newBlocklistSubject(request, email))
+}
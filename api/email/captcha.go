@@ -0,0 +1,20 @@
+package email
+
+import (
+	"errors"
+	"net/http"
+
+	"portfolio-back/captcha"
+)
+
+// writeCaptchaProblem tells apart the CAPTCHAs which were not solved from the ones which could not be checked,
+// rather than suggesting to send an email which would not be needed once the CAPTCHA is solved.
+func writeCaptchaProblem(response http.ResponseWriter, request *http.Request, err error) {
+	if errors.Is(err, captcha.ErrRejected) {
+		problem := newProblem(http.StatusForbidden, "The CAPTCHA was not solved")
+		problem.Errors = []fieldError{{Field: "CaptchaToken", Code: "captcha_failed", Message: "must be a solved CAPTCHA"}}
+		writeError(response, request, problem)
+	} else {
+		writeError(response, request, newProblem(http.StatusServiceUnavailable, "The CAPTCHA could not be checked, please retry"))
+	}
+}
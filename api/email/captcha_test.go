@@ -0,0 +1,79 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"portfolio-back/captcha"
+)
+
+// stubVerifier only accepts the "solved" CAPTCHA token, or fails with err if set.
+type stubVerifier struct {
+	err error
+}
+
+func (verifier stubVerifier) Verify(_ context.Context, token string, _ string) error {
+	if verifier.err != nil {
+		return verifier.err
+	}
+	if token != "solved" {
+		return captcha.ErrRejected
+	}
+	return nil
+}
+
+func TestRequireCaptcha(t *testing.T) {
+	for token, expectedStatus := range map[string]int{
+		"solved":   http.StatusOK,
+		"unsolved": http.StatusForbidden,
+		"":         http.StatusForbidden,
+	} {
+		mailTransport := &fakeTransport{}
+		handlePostEmail, err := HandlePostEmail(mailTransport, stubVerifier{}, nil, mockGetEnvWithServerPort(0))
+		require.Nil(t, err, "Failed to set up email handler: %s\n", err)
+		form := "Sender=Test+sender&Subject=Test+subject&Body=Test+body&cf-turnstile-response=" + token
+		response := post(handlePostEmail, "application/x-www-form-urlencoded", form, acceptJson)
+
+		assert.Equal(t, expectedStatus, response.Code, "Unexpected status for token %q", token)
+		if expectedStatus == http.StatusOK {
+			continue
+		}
+		assert.Nil(t, mailTransport.lastMessage(), "Email was sent despite token %q", token)
+		var body problemDetails
+		require.Nil(t, json.NewDecoder(response.Body).Decode(&body))
+		assert.Equal(t, "captcha_failed", body.Errors[0].Code)
+		assert.Empty(t, body.MailtoUrl)
+	}
+}
+
+func TestRespondWithProblemWhenCaptchaUnavailable(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	handlePostEmail, err := HandlePostEmail(mailTransport, stubVerifier{err: errors.New("timeout")}, nil, mockGetEnvWithServerPort(0))
+	require.Nil(t, err, "Failed to set up email handler: %s\n", err)
+	email := newTestRequestBody(emailSubject, emailSender)
+	email.CaptchaToken = "solved"
+	response := postJson(t, handlePostEmail, email, acceptJson)
+
+	assert.Equal(t, http.StatusServiceUnavailable, response.Code)
+	assert.Equal(t, "application/problem+json", response.Header().Get("Content-Type"))
+	assert.Nil(t, mailTransport.lastMessage())
+}
+
+func TestRespondWithTextToBrowsersWhenCaptchaNotSolved(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	handlePostEmail, err := HandlePostEmail(mailTransport, stubVerifier{}, nil, mockGetEnvWithServerPort(0))
+	require.Nil(t, err, "Failed to set up email handler: %s\n", err)
+	form := "Sender=Test+sender&Subject=Test+subject&Body=Test+body&cf-turnstile-response=unsolved"
+	response := post(handlePostEmail, "application/x-www-form-urlencoded", form, nil)
+
+	assert.Equal(t, http.StatusForbidden, response.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", response.Header().Get("Content-Type"))
+	assert.Equal(t, "The CAPTCHA was not solved\nCaptchaToken must be a solved CAPTCHA\n", response.Body.String())
+	assert.Nil(t, mailTransport.lastMessage())
+}
@@ -0,0 +1,97 @@
+package email
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// maxTextRequestSize bounds the bodies of requests without attachments.
+var maxTextRequestSize = maxFormFieldSize * int64(len(fieldRules))
+
+// setFormField maps a submitted form field onto the request body, reporting whether the field is known.
+func setFormField(email *requestBody, name string, value string) bool {
+	switch name {
+	case "Sender":
+		email.Sender = value
+	case "SenderEmail":
+		email.SenderEmail = value
+	case "Subject":
+		email.Subject = value
+	case "Body":
+		email.Body = value
+	case "SuccessRedirectUrl":
+		email.SuccessRedirectUrl = value
+	case "Website":
+		email.Website = value
+	case "FormToken":
+		email.FormToken = value
+	// Also accepts the fields which CAPTCHA widgets add to the forms they are embedded in.
+	case "CaptchaToken", "g-recaptcha-response", "h-captcha-response", "cf-turnstile-response":
+		email.CaptchaToken = value
+	default:
+		return false
+	}
+	return true
+}
+
+func decodeJson(request *http.Request) (*requestBody, *requestError) {
+	request.Body = http.MaxBytesReader(nil, request.Body, maxTextRequestSize)
+	decoder := json.NewDecoder(request.Body)
+	decoder.DisallowUnknownFields()
+	email := &requestBody{}
+	err := decoder.Decode(email)
+	if err == nil {
+		if _, trailingErr := decoder.Token(); trailingErr != io.EOF {
+			err = errors.New("unexpected data after the JSON object")
+		}
+	}
+	if err == nil {
+		return email, nil
+	}
+
+	var maxBytesError *http.MaxBytesError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &maxBytesError):
+		return nil, bodyTooLargeError(maxBytesError)
+	case errors.As(err, &typeError) && typeError.Field != "":
+		return nil, newRequestError(http.StatusBadRequest, typeError.Field, "invalid_type", "must be a string")
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		return nil, newRequestError(http.StatusBadRequest, field, "unknown_field", "is not allowed")
+	default:
+		return nil, newRequestError(http.StatusBadRequest, "", "malformed_body", "must be a valid JSON object")
+	}
+}
+
+// decodeUrlEncodedForm maps a classic HTML form submission onto the request body.
+func decodeUrlEncodedForm(request *http.Request) (*requestBody, *requestError) {
+	request.Body = http.MaxBytesReader(nil, request.Body, maxTextRequestSize)
+	err := request.ParseForm()
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			return nil, bodyTooLargeError(maxBytesError)
+		}
+		return nil, newRequestError(http.StatusBadRequest, "", "malformed_body", "must be a valid URL-encoded form")
+	}
+	email := &requestBody{}
+	requestErr := &requestError{status: http.StatusBadRequest}
+	for name, values := range request.PostForm {
+		if !setFormField(email, name, values[0]) {
+			requestErr.fields = append(requestErr.fields, fieldError{Field: name, Code: "unknown_field", Message: "is not allowed"})
+		}
+	}
+	if len(requestErr.fields) > 0 {
+		return nil, requestErr
+	}
+	return email, nil
+}
+
+func bodyTooLargeError(maxBytesError *http.MaxBytesError) *requestError {
+	return newRequestError(http.StatusRequestEntityTooLarge, "", "body_too_large", fmt.Sprintf("must not exceed %d bytes", maxBytesError.Limit))
+}
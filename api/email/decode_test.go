@@ -0,0 +1,132 @@
+package email
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcceptUrlEncodedForm(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	form := url.Values{}
+	for name, value := range newTestFormFields() {
+		form.Set(name, value)
+	}
+	form.Set("SenderEmail", "jane@test.com")
+	response := post(newTestHandler(t, mailTransport, nil), "application/x-www-form-urlencoded", form.Encode(), nil)
+
+	require.Equal(t, http.StatusFound, response.Code)
+	assert.Equal(t, successRedirectUrl, response.Header().Get("Location"))
+	require.NotNil(t, mailTransport.lastMessage())
+	assert.Equal(t, emailSubject, mailTransport.lastMessage().Subject)
+	assert.Equal(t, "jane@test.com", mailTransport.lastMessage().ReplyTo.Address)
+	assert.True(t, strings.HasPrefix(mailTransport.lastMessage().Text, emailBody+"\n"))
+}
+
+func TestRejectUnknownUrlEncodedFields(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	form := url.Values{}
+	for name, value := range newTestFormFields() {
+		form.Set(name, value)
+	}
+	form.Set("Phone", "0123456789")
+	response := post(newTestHandler(t, mailTransport, nil), "application/x-www-form-urlencoded", form.Encode(), acceptJson)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	var body problemDetails
+	require.Nil(t, json.NewDecoder(response.Body).Decode(&body))
+	assert.Equal(t, []fieldError{{Field: "Phone", Code: "unknown_field", Message: "is not allowed"}}, body.Errors)
+	assert.Nil(t, mailTransport.lastMessage())
+}
+
+func TestRejectInvalidJson(t *testing.T) {
+	for name, testCase := range map[string]struct {
+		body           string
+		expectedStatus int
+		expectedError  fieldError
+	}{
+		"malformed": {
+			body:           `{"Sender": "Jane"`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  fieldError{Code: "malformed_body", Message: "must be a valid JSON object"},
+		},
+		"trailing data": {
+			body:           `{"Sender": "Jane"} {}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  fieldError{Code: "malformed_body", Message: "must be a valid JSON object"},
+		},
+		"not an object": {
+			body:           `["Jane"]`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  fieldError{Code: "malformed_body", Message: "must be a valid JSON object"},
+		},
+		"unknown field": {
+			body:           `{"Sender": "Jane", "Bcc": "attacker@test.com"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  fieldError{Field: "Bcc", Code: "unknown_field", Message: "is not allowed"},
+		},
+		"wrong type": {
+			body:           `{"Sender": "Jane", "Subject": 42}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  fieldError{Field: "Subject", Code: "invalid_type", Message: "must be a string"},
+		},
+		"too large": {
+			body:           `{"Body": "` + strings.Repeat("a", int(maxTextRequestSize)) + `"}`,
+			expectedStatus: http.StatusRequestEntityTooLarge,
+			expectedError:  fieldError{Code: "body_too_large", Message: fmt.Sprintf("must not exceed %d bytes", maxTextRequestSize)},
+		},
+		"null": {
+			body:           `null`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  fieldError{Field: "Sender", Code: "required", Message: "is required"},
+		},
+	} {
+		mailTransport := &fakeTransport{}
+		response := post(newTestHandler(t, mailTransport, nil), "application/json", testCase.body, acceptJson)
+
+		assert.Equal(t, testCase.expectedStatus, response.Code, "Unexpected status for %s", name)
+		var body problemDetails
+		require.Nil(t, json.NewDecoder(response.Body).Decode(&body))
+		require.NotEmpty(t, body.Errors, "No errors for %s", name)
+		assert.Equal(t, testCase.expectedError, body.Errors[0], "Unexpected error for %s", name)
+		assert.Nil(t, mailTransport.lastMessage(), "Email was sent despite %s", name)
+	}
+}
+
+func TestRejectOversizedUrlEncodedForm(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	form := url.Values{"Body": {strings.Repeat("a", maxFormFieldSize*len(fieldRules))}}
+	response := post(newTestHandler(t, mailTransport, nil), "application/x-www-form-urlencoded", form.Encode(), nil)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+	assert.Nil(t, mailTransport.lastMessage())
+}
+
+func TestAcceptJsonWithCharset(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	body, err := json.Marshal(newTestRequestBody(emailSubject, emailSender))
+	require.Nil(t, err)
+	response := post(newTestHandler(t, mailTransport, nil), "application/json; charset=utf-8", string(body), nil)
+
+	assert.Equal(t, http.StatusFound, response.Code)
+	assert.NotNil(t, mailTransport.lastMessage())
+}
+
+func TestRejectUnsupportedMediaType(t *testing.T) {
+	for _, contentType := range []string{"text/plain", "application/xml", "invalid;;", "/"} {
+		mailTransport := &fakeTransport{}
+		response := post(newTestHandler(t, mailTransport, nil), contentType, "Sender=Jane", acceptJson)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, response.Code, "Unexpected status for %s", contentType)
+		var body problemDetails
+		require.Nil(t, json.NewDecoder(response.Body).Decode(&body))
+		assert.Equal(t, "unsupported_media_type", body.Errors[0].Code)
+		assert.Nil(t, mailTransport.lastMessage())
+	}
+}
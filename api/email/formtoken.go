@@ -0,0 +1,107 @@
+package email
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"portfolio-back/config"
+)
+
+const maxFormTokenLength = 128
+
+// formTokens issues and verifies the tokens with which forms are submitted,
+// which are signed with FORM_TOKEN_SECRET and carry the time at which the form was loaded.
+type formTokens struct {
+	secret      []byte
+	minFillTime time.Duration
+	maxAge      time.Duration
+}
+
+type formTokenBody struct {
+	Token string `json:"token"`
+}
+
+// loadFormTokens returns nil if FORM_TOKEN_SECRET is not set, in which case no token is required.
+func loadFormTokens(getEnv func(string) string) *formTokens {
+	secret := getEnv("FORM_TOKEN_SECRET")
+	if secret == "" {
+		return nil
+	}
+	return &formTokens{
+		secret:      []byte(secret),
+		minFillTime: config.Milliseconds(getEnv, "FORM_MIN_FILL_TIME", 3*time.Second),
+		maxAge:      config.Milliseconds(getEnv, "FORM_TOKEN_MAX_AGE", 24*time.Hour),
+	}
+}
+
+// HandleGetFormToken issues the token which the contact form must submit in its FormToken field.
+func HandleGetFormToken(getEnv func(string) string) http.HandlerFunc {
+	tokens := loadFormTokens(getEnv)
+
+	return func(response http.ResponseWriter, request *http.Request) {
+		if tokens == nil {
+			writeProblem(response, newProblem(http.StatusNotFound, "Form tokens are disabled"))
+			return
+		}
+		response.Header().Set("Cache-Control", "no-store")
+		writeJson(response, http.StatusOK, "application/json", &formTokenBody{Token: tokens.issue(time.Now())})
+	}
+}
+
+// issue returns the issue time in milliseconds, followed by its signature.
+func (tokens *formTokens) issue(now time.Time) string {
+	issuedAt := strconv.FormatInt(now.UnixMilli(), 10)
+	return issuedAt + "." + tokens.sign(issuedAt)
+}
+
+// verify returns the time at which the token was issued, unless it is forged or expired.
+func (tokens *formTokens) verify(token string, now time.Time) (time.Time, error) {
+	rawIssuedAt, signature, found := strings.Cut(token, ".")
+	if !found || !hmac.Equal([]byte(signature), []byte(tokens.sign(rawIssuedAt))) {
+		return time.Time{}, errors.New("invalid signature")
+	}
+	issuedAtMilliseconds, err := strconv.ParseInt(rawIssuedAt, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	issuedAt := time.UnixMilli(issuedAtMilliseconds)
+	if now.Sub(issuedAt) > tokens.maxAge {
+		return time.Time{}, errors.New("expired")
+	}
+	return issuedAt, nil
+}
+
+func (tokens *formTokens) sign(issuedAt string) string {
+	mac := hmac.New(sha256.New, tokens.secret)
+	mac.Write([]byte(issuedAt))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// detectBot reports why a submission comes from a bot, if it filled the honeypot or was submitted too fast.
+// A missing or invalid token is not a proof of a bot, since a visitor may have kept the page open for long,
+// so it is reported as a field error instead.
+func (tokens *formTokens) detectBot(email *requestBody, now time.Time) (reason string, requestErr *requestError) {
+	if email.Website != "" {
+		return "filled the honeypot", nil
+	}
+	if tokens == nil {
+		return "", nil
+	}
+	if email.FormToken == "" {
+		return "", newRequestError(http.StatusBadRequest, "FormToken", "required", "is required")
+	}
+	issuedAt, err := tokens.verify(email.FormToken, now)
+	if err != nil {
+		return "", newRequestError(http.StatusBadRequest, "FormToken", "invalid_form_token", "must be a valid form token, reload the page to get a new one")
+	}
+	if fillTime := now.Sub(issuedAt); fillTime < tokens.minFillTime {
+		return "filled the form in " + fillTime.String(), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,116 @@
+package email
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testFormTokenSecret = "secret"
+
+var formTokenEnv = map[string]string{"FORM_TOKEN_SECRET": testFormTokenSecret}
+
+func TestIssueAndVerifyFormToken(t *testing.T) {
+	tokens := newTestFormTokens()
+	issuedAt := time.UnixMilli(time.Now().UnixMilli())
+	token := tokens.issue(issuedAt)
+
+	verifiedIssuedAt, err := tokens.verify(token, issuedAt.Add(time.Minute))
+	require.Nil(t, err)
+	assert.Equal(t, issuedAt, verifiedIssuedAt)
+
+	_, err = tokens.verify(token, issuedAt.Add(25*time.Hour))
+	assert.NotNil(t, err, "Expired token was accepted")
+	forged := (&formTokens{secret: []byte("other"), maxAge: time.Hour}).issue(issuedAt)
+	_, err = tokens.verify(forged, issuedAt)
+	assert.NotNil(t, err, "Forged token was accepted")
+	rawIssuedAt, signature, _ := strings.Cut(token, ".")
+	_, err = tokens.verify(rawIssuedAt+"1."+signature, issuedAt)
+	assert.NotNil(t, err, "Tampered token was accepted")
+	for _, malformed := range []string{"", ".", "abc", "abc." + tokens.sign("abc")} {
+		_, err = tokens.verify(malformed, issuedAt)
+		assert.NotNil(t, err, "Malformed token %q was accepted", malformed)
+	}
+}
+
+func TestGetFormToken(t *testing.T) {
+	handleGetFormToken := HandleGetFormToken(mockGetEnv(map[string]string{"FORM_TOKEN_SECRET": testFormTokenSecret}))
+	response := httptest.NewRecorder()
+	handleGetFormToken(response, httptest.NewRequest(http.MethodGet, "/api/email/token", nil))
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "no-store", response.Header().Get("Cache-Control"))
+	var body formTokenBody
+	require.Nil(t, json.NewDecoder(response.Body).Decode(&body))
+	_, err := newTestFormTokens().verify(body.Token, time.Now())
+	assert.Nil(t, err)
+}
+
+func TestGetFormTokenWhenDisabled(t *testing.T) {
+	response := httptest.NewRecorder()
+	HandleGetFormToken(mockGetEnv(nil))(response, httptest.NewRequest(http.MethodGet, "/api/email/token", nil))
+
+	assert.Equal(t, http.StatusNotFound, response.Code)
+}
+
+func TestSendEmailWithFormToken(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	email := newTestRequestBody(emailSubject, emailSender)
+	email.FormToken = newTestFormTokens().issue(time.Now().Add(-time.Minute))
+	response := postJson(t, newTestHandler(t, mailTransport, formTokenEnv), email, acceptJson)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.NotNil(t, mailTransport.lastMessage())
+}
+
+func TestDropBotSubmissions(t *testing.T) {
+	for name, email := range map[string]*requestBody{
+		"honeypot": {Sender: "Bot", Subject: "Buy now", Body: "Cheap stuff", Website: "http://spam.test",
+			FormToken: newTestFormTokens().issue(time.Now().Add(-time.Minute))},
+		"too fast":       {Sender: "Bot", Subject: "Buy now", Body: "Cheap stuff", FormToken: newTestFormTokens().issue(time.Now())},
+		"invalid fields": {Sender: "B", Body: "Cheap\x00stuff", Website: "http://spam.test"},
+	} {
+		mailTransport := &fakeTransport{}
+		response := postJson(t, newTestHandler(t, mailTransport, formTokenEnv), email, acceptJson)
+
+		assert.Equal(t, http.StatusOK, response.Code, "Bot was not answered normally for %s", name)
+		var body successBody
+		require.Nil(t, json.NewDecoder(response.Body).Decode(&body))
+		assert.Equal(t, "sent", body.Status)
+		assert.NotEmpty(t, body.MessageId)
+		assert.Nil(t, mailTransport.lastMessage(), "Email was sent for %s", name)
+	}
+}
+
+func TestRejectInvalidFormTokens(t *testing.T) {
+	for token, expectedCode := range map[string]string{
+		"":                     "required",
+		"1717243200000.forged": "invalid_form_token",
+		newExpiredFormToken():  "invalid_form_token",
+	} {
+		mailTransport := &fakeTransport{}
+		email := newTestRequestBody(emailSubject, emailSender)
+		email.FormToken = token
+		response := postJson(t, newTestHandler(t, mailTransport, formTokenEnv), email, acceptJson)
+
+		assert.Equal(t, http.StatusBadRequest, response.Code)
+		var body problemDetails
+		require.Nil(t, json.NewDecoder(response.Body).Decode(&body))
+		assert.Equal(t, []fieldError{{Field: "FormToken", Code: expectedCode, Message: body.Errors[0].Message}}, body.Errors)
+		assert.Nil(t, mailTransport.lastMessage())
+	}
+}
+
+func newTestFormTokens() *formTokens {
+	return loadFormTokens(mockGetEnv(formTokenEnv))
+}
+
+func newExpiredFormToken() string {
+	return newTestFormTokens().issue(time.Now().Add(-25 * time.Hour))
+}
@@ -0,0 +1,101 @@
+package email
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"portfolio-back/transport"
+)
+
+// acceptJson is the header of API clients, which are answered with JSON rather than redirections.
+var acceptJson = http.Header{"Accept": {"application/json"}}
+
+// fakeTransport keeps every message it was asked to send,
+// and fails to send while failing is set, or to failingRecipient.
+type fakeTransport struct {
+	mutex            sync.Mutex
+	messages         []*transport.Message
+	failing          bool
+	failingRecipient string
+}
+
+func (mailTransport *fakeTransport) Send(_ context.Context, message *transport.Message) error {
+	mailTransport.mutex.Lock()
+	defer mailTransport.mutex.Unlock()
+	if mailTransport.failing || (len(message.To) > 0 && message.To[0] == mailTransport.failingRecipient) {
+		return errors.New("relay unavailable")
+	}
+	mailTransport.messages = append(mailTransport.messages, message)
+	return nil
+}
+
+func (mailTransport *fakeTransport) Close() {}
+
+// lastMessage returns the last message sent, or nil if there is none.
+func (mailTransport *fakeTransport) lastMessage() *transport.Message {
+	mailTransport.mutex.Lock()
+	defer mailTransport.mutex.Unlock()
+	if len(mailTransport.messages) == 0 {
+		return nil
+	}
+	return mailTransport.messages[len(mailTransport.messages)-1]
+}
+
+func mockGetEnv(env map[string]string) func(string) string {
+	return func(key string) string {
+		return env[key]
+	}
+}
+
+// newTestHandler sets up the email handler with the shared test configuration, overridden by env.
+func newTestHandler(t *testing.T, mailTransport transport.Transport, env map[string]string) http.HandlerFunc {
+	testEnv := newTestEnv(0)
+	maps.Copy(testEnv, env)
+	handlePostEmail, err := HandlePostEmail(mailTransport, nil, nil, mockGetEnv(testEnv))
+	require.Nil(t, err, "Failed to set up email handler: %s\n", err)
+	return handlePostEmail
+}
+
+// postJson posts the email encoded as JSON, with the given headers.
+func postJson(t *testing.T, handlePostEmail http.HandlerFunc, email *requestBody, header http.Header) *httptest.ResponseRecorder {
+	requestBody, err := json.Marshal(email)
+	require.Nil(t, err, "Failed to encode request body: %s\n", err)
+	return post(handlePostEmail, "application/json", string(requestBody), header)
+}
+
+// post sends the body to the handler with the given content type and headers, and records the response.
+func post(handlePostEmail http.HandlerFunc, contentType string, body string, header http.Header) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/api/email", strings.NewReader(body))
+	request.Header.Set("Content-Type", contentType)
+	for name, values := range header {
+		request.Header[name] = values
+	}
+	response := httptest.NewRecorder()
+	handlePostEmail(response, request)
+	return response
+}
+
+// decodeSuccessBody decodes the JSON response to a successful submission.
+func decodeSuccessBody(t *testing.T, response *httptest.ResponseRecorder) *successBody {
+	var body successBody
+	require.Nil(t, json.NewDecoder(response.Body).Decode(&body), "Failed to decode response body")
+	return &body
+}
+
+func newTestRequestBody(subject string, sender string) *requestBody {
+	return &requestBody{
+		Sender:             sender,
+		Subject:            subject,
+		Body:               emailBody,
+		SuccessRedirectUrl: successRedirectUrl,
+	}
+}
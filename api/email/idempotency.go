@@ -0,0 +1,169 @@
+package email
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"portfolio-back/config"
+	"portfolio-back/store"
+	"portfolio-back/transport"
+)
+
+const (
+	maxIdempotencyKeyLength = 255
+	// Bounds how long a request is reported as being processed, in case its instance died meanwhile.
+	maxProcessingDuration = 5 * time.Minute
+)
+
+// idempotencyGuard remembers the responses to successful requests, so that retries and double submissions
+// get the original response replayed rather than sending the email again.
+// Requests are identified by their Idempotency-Key header, or by the fingerprint of their content otherwise.
+type idempotencyGuard struct {
+	store             store.Store
+	keyTtl            time.Duration
+	fingerprintWindow time.Duration
+}
+
+// idempotentRequest is how a request is remembered.
+type idempotentRequest struct {
+	storeKey    string
+	fingerprint string
+	ttl         time.Duration
+	// Whether the client chose the key, in which case reusing it for another content is an error.
+	hasClientKey bool
+}
+
+type storedResponse struct {
+	InProgress  bool
+	Fingerprint string
+	Status      int
+	Header      http.Header
+	Body        []byte
+}
+
+// responseRecorder captures the response while writing it, so that it can be replayed.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (recorder *responseRecorder) WriteHeader(status int) {
+	recorder.status = status
+	recorder.ResponseWriter.WriteHeader(status)
+}
+
+func (recorder *responseRecorder) Write(content []byte) (int, error) {
+	if recorder.status == 0 {
+		recorder.status = http.StatusOK
+	}
+	recorder.body.Write(content)
+	return recorder.ResponseWriter.Write(content)
+}
+
+func loadIdempotencyGuard(getEnv func(string) string) (*idempotencyGuard, error) {
+	idempotencyStore, err := store.New(getEnv, "IDEMPOTENCY")
+	if err != nil {
+		return nil, err
+	}
+	return &idempotencyGuard{
+		store:             idempotencyStore,
+		keyTtl:            config.Milliseconds(getEnv, "IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+		fingerprintWindow: config.Milliseconds(getEnv, "IDEMPOTENCY_FINGERPRINT_WINDOW", 10*time.Minute),
+	}, nil
+}
+
+// identify returns nil if the request has no Idempotency-Key and fingerprinting is disabled.
+func (guard *idempotencyGuard) identify(request *http.Request, email *requestBody, attachments []*transport.Attachment) (*idempotentRequest, *requestError) {
+	fingerprint := fingerprintEmail(email, attachments)
+	key := request.Header.Get("Idempotency-Key")
+	if key == "" && guard.fingerprintWindow <= 0 {
+		return nil, nil
+	}
+	if key == "" {
+		return &idempotentRequest{storeKey: "fingerprint:" + fingerprint, fingerprint: fingerprint, ttl: guard.fingerprintWindow}, nil
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, newRequestError(http.StatusBadRequest, "", "invalid_idempotency_key", "Idempotency-Key must not exceed 255 bytes")
+	}
+	return &idempotentRequest{storeKey: "key:" + key, fingerprint: fingerprint, ttl: guard.keyTtl, hasClientKey: true}, nil
+}
+
+// fingerprintEmail hashes the content of the email, attachments included.
+func fingerprintEmail(email *requestBody, attachments []*transport.Attachment) string {
+	hash := sha256.New()
+	for _, value := range []string{email.Sender, email.SenderEmail, email.Subject, email.Body} {
+		hash.Write([]byte(value))
+		hash.Write([]byte{0})
+	}
+	for _, attachment := range attachments {
+		hash.Write([]byte(attachment.Filename))
+		hash.Write([]byte{0})
+		hash.Write(attachment.Content)
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// claim marks the request as being processed, unless it was already seen, in which case the previous response is returned.
+func (guard *idempotencyGuard) claim(idempotent *idempotentRequest) (*storedResponse, error) {
+	var previous *storedResponse
+	err := guard.store.Update(idempotent.storeKey, func(entry *store.Entry) *store.Entry {
+		if entry != nil {
+			previous = &storedResponse{}
+			if err := json.Unmarshal(entry.Value, previous); err == nil {
+				return entry
+			}
+			log.Printf("[ERROR] Discarding unreadable idempotent response of %s\n", idempotent.storeKey)
+			previous = nil
+		}
+		value, _ := json.Marshal(&storedResponse{InProgress: true, Fingerprint: idempotent.fingerprint})
+		return &store.Entry{Value: value, ExpiresAt: time.Now().Add(min(maxProcessingDuration, idempotent.ttl))}
+	})
+	return previous, err
+}
+
+// complete remembers the responses of delivered requests, and forgets failed ones so that they can be retried,
+// even though browsers are answered with a redirection on failure.
+func (guard *idempotencyGuard) complete(idempotent *idempotentRequest, recorder *responseRecorder, delivered bool) {
+	err := guard.store.Update(idempotent.storeKey, func(*store.Entry) *store.Entry {
+		if !delivered || recorder.status == 0 {
+			return nil
+		}
+		value, err := json.Marshal(&storedResponse{
+			Fingerprint: idempotent.fingerprint,
+			Status:      recorder.status,
+			Header:      recorder.Header().Clone(),
+			Body:        recorder.body.Bytes(),
+		})
+		if err != nil {
+			return nil
+		}
+		return &store.Entry{Value: value, ExpiresAt: time.Now().Add(idempotent.ttl)}
+	})
+	if err != nil {
+		log.Printf("[ERROR] Failed to remember idempotent response of %s: %s\n", idempotent.storeKey, err)
+	}
+}
+
+// replay answers a request which was already seen.
+func (guard *idempotencyGuard) replay(response http.ResponseWriter, request *http.Request, idempotent *idempotentRequest, previous *storedResponse) {
+	switch {
+	case idempotent.hasClientKey && previous.Fingerprint != idempotent.fingerprint:
+		writeError(response, request, newProblem(http.StatusUnprocessableEntity, "The Idempotency-Key was already used for another request"))
+	case previous.InProgress:
+		writeError(response, request, newProblem(http.StatusConflict, "The same request is already being processed"))
+	default:
+		for name, values := range previous.Header {
+			response.Header()[name] = values
+		}
+		response.Header().Set("Idempotent-Replayed", "true")
+		response.WriteHeader(previous.Status)
+		response.Write(previous.Body)
+	}
+}
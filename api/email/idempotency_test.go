@@ -0,0 +1,153 @@
+package email
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"portfolio-back/store"
+	"portfolio-back/transport"
+)
+
+// Fingerprinting is disabled by the shared test configuration.
+var fingerprintingEnv = map[string]string{"IDEMPOTENCY_FINGERPRINT_WINDOW": "60000"}
+
+func TestReplayDuplicateSubmissions(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	handlePostEmail := newTestHandler(t, mailTransport, fingerprintingEnv)
+
+	first := postJson(t, handlePostEmail, newTestRequestBody(emailSubject, emailSender), acceptJson)
+	second := postJson(t, handlePostEmail, newTestRequestBody(emailSubject, emailSender), acceptJson)
+
+	assert.Len(t, mailTransport.messages, 1)
+	assert.Equal(t, http.StatusOK, second.Code)
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, "application/json", second.Header().Get("Content-Type"))
+	assert.Equal(t, "true", second.Header().Get("Idempotent-Replayed"))
+	assert.Empty(t, first.Header().Get("Idempotent-Replayed"))
+
+	postJson(t, handlePostEmail, newAnotherTestRequestBody(), acceptJson)
+	assert.Len(t, mailTransport.messages, 2)
+}
+
+func TestReplayRedirects(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	handlePostEmail := newTestHandler(t, mailTransport, fingerprintingEnv)
+	form := "Sender=Test+sender&Subject=Test+subject&Body=Test+body&SuccessRedirectUrl=http%3A%2F%2Flocalhost%2Fsuccess"
+	var responses []*httptest.ResponseRecorder
+	for range 2 {
+		responses = append(responses, post(handlePostEmail, "application/x-www-form-urlencoded", form, nil))
+	}
+
+	assert.Len(t, mailTransport.messages, 1)
+	assert.Equal(t, http.StatusFound, responses[1].Code)
+	assert.Equal(t, responses[0].Header().Get("Location"), responses[1].Header().Get("Location"))
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	handlePostEmail := newTestHandler(t, mailTransport, nil)
+
+	postJson(t, handlePostEmail, newTestRequestBody(emailSubject, emailSender), withIdempotencyKey("first-key"))
+	replayed := postJson(t, handlePostEmail, newTestRequestBody(emailSubject, emailSender), withIdempotencyKey("first-key"))
+	assert.Len(t, mailTransport.messages, 1)
+	assert.Equal(t, http.StatusOK, replayed.Code)
+
+	postJson(t, handlePostEmail, newTestRequestBody(emailSubject, emailSender), withIdempotencyKey("second-key"))
+	postJson(t, handlePostEmail, newTestRequestBody(emailSubject, emailSender), acceptJson)
+	postJson(t, handlePostEmail, newTestRequestBody(emailSubject, emailSender), acceptJson)
+	assert.Len(t, mailTransport.messages, 4)
+
+	reused := postJson(t, handlePostEmail, newAnotherTestRequestBody(), withIdempotencyKey("first-key"))
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+	assert.Len(t, mailTransport.messages, 4)
+
+	tooLong := postJson(t, handlePostEmail, newTestRequestBody(emailSubject, emailSender), withIdempotencyKey(strings.Repeat("k", maxIdempotencyKeyLength+1)))
+	assert.Equal(t, http.StatusBadRequest, tooLong.Code)
+}
+
+func TestRetryFailedSubmissions(t *testing.T) {
+	mailTransport := &fakeTransport{failing: true}
+	handlePostEmail := newTestHandler(t, mailTransport, fingerprintingEnv)
+
+	failed := postJson(t, handlePostEmail, newTestRequestBody(emailSubject, emailSender), withIdempotencyKey("key"))
+	assert.Equal(t, http.StatusBadGateway, failed.Code)
+
+	mailTransport.failing = false
+	retried := postJson(t, handlePostEmail, newTestRequestBody(emailSubject, emailSender), withIdempotencyKey("key"))
+	assert.Equal(t, http.StatusOK, retried.Code)
+	assert.Len(t, mailTransport.messages, 1)
+}
+
+func TestRetryFailedFormSubmissions(t *testing.T) {
+	mailTransport := &fakeTransport{failing: true}
+	handlePostEmail := newTestHandler(t, mailTransport, fingerprintingEnv)
+	form := "Sender=Test+sender&Subject=Test+subject&Body=Test+body"
+
+	failed := post(handlePostEmail, "application/x-www-form-urlencoded", form, nil)
+	assert.Equal(t, http.StatusSeeOther, failed.Code)
+	assert.True(t, strings.HasPrefix(failed.Header().Get("Location"), "mailto:"))
+
+	mailTransport.failing = false
+	retried := post(handlePostEmail, "application/x-www-form-urlencoded", form, nil)
+	assert.Equal(t, http.StatusFound, retried.Code)
+	assert.Empty(t, retried.Header().Get("Idempotent-Replayed"))
+	assert.Len(t, mailTransport.messages, 1)
+}
+
+func TestRejectConcurrentDuplicates(t *testing.T) {
+	guard := &idempotencyGuard{store: store.NewMemory(), keyTtl: time.Hour, fingerprintWindow: time.Hour}
+	idempotent := &idempotentRequest{storeKey: "key:key", fingerprint: "fingerprint", ttl: time.Hour, hasClientKey: true}
+
+	previous, err := guard.claim(idempotent)
+	require.Nil(t, err)
+	assert.Nil(t, previous)
+	previous, err = guard.claim(idempotent)
+	require.Nil(t, err)
+	require.NotNil(t, previous)
+
+	for contentType, header := range map[string]http.Header{
+		"application/problem+json":  acceptJson,
+		"text/plain; charset=utf-8": nil,
+	} {
+		request := httptest.NewRequest(http.MethodPost, "/api/email", nil)
+		for name, values := range header {
+			request.Header[name] = values
+		}
+		response := httptest.NewRecorder()
+		guard.replay(response, request, idempotent, previous)
+		assert.Equal(t, http.StatusConflict, response.Code)
+		assert.Equal(t, contentType, response.Header().Get("Content-Type"))
+	}
+}
+
+func TestFingerprintEmail(t *testing.T) {
+	email := newTestRequestBody(emailSubject, emailSender)
+	attachment := &transport.Attachment{Filename: "cv.pdf", Content: []byte("%PDF")}
+
+	assert.Equal(t, fingerprintEmail(email, nil), fingerprintEmail(newTestRequestBody(emailSubject, emailSender), nil))
+	assert.NotEqual(t, fingerprintEmail(email, nil), fingerprintEmail(email, []*transport.Attachment{attachment}))
+	// Fields are delimited, so that content cannot move from a field to the next.
+	assert.NotEqual(
+		t,
+		fingerprintEmail(&requestBody{Sender: "ab", Subject: "c"}, nil),
+		fingerprintEmail(&requestBody{Sender: "a", Subject: "bc"}, nil),
+	)
+}
+
+func newAnotherTestRequestBody() *requestBody {
+	email := newTestRequestBody(emailSubject, emailSender)
+	email.Body = "Another body"
+	return email
+}
+
+func withIdempotencyKey(idempotencyKey string) http.Header {
+	header := acceptJson.Clone()
+	header.Set("Idempotency-Key", idempotencyKey)
+	return header
+}
@@ -1,183 +1,106 @@
 package email
 
 import (
-	"context"
-	"crypto/tls"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"io"
 	"log"
-	"net"
+	"mime"
 	"net/http"
-	"net/smtp"
 	"net/url"
-	"sync"
-)
-
-var errCancelled = errors.New("POST /api/email request was cancelled")
+	"strings"
+	"time"
 
-type smtpServer struct {
-	Host string
-	Port string
-}
+	"portfolio-back/blocklist"
+	"portfolio-back/captcha"
+	"portfolio-back/config"
+	"portfolio-back/spam"
+	"portfolio-back/transport"
+)
 
-func (server *smtpServer) Name() string {
-	return server.Host + ":" + server.Port
-}
+var supportedMediaTypes = []string{"application/json", "application/x-www-form-urlencoded", "multipart/form-data"}
 
 type requestBody struct {
 	Sender             string
 	Subject            string
 	Body               string
 	SuccessRedirectUrl string
+	// Optional address to which replies are sent, possibly with a display name.
+	SenderEmail string
+	// Honeypot hidden from visitors, so that only bots fill it.
+	Website string
+	// Issued by GET /api/email/token when the form was loaded.
+	FormToken string
+	// Solution of the CAPTCHA, required if a CAPTCHA verifier is configured.
+	CaptchaToken string
 }
 
+// HandlePostEmail forwards the submitted emails through mailTransport.
+// Submissions must solve a CAPTCHA if captchaVerifier is not nil,
+// and are blocked or allowed by the rules of senderBlocklist if it is not nil.
 func HandlePostEmail(
-	appContext context.Context,
-	shutdownWaitGroup *sync.WaitGroup,
+	mailTransport transport.Transport,
+	captchaVerifier captcha.Verifier,
+	senderBlocklist *blocklist.Blocklist,
 	getEnv func(string) string,
-) http.HandlerFunc {
+) (http.HandlerFunc, error) {
 
-	smtpClientDomain := getEnv("SMTP_CLIENT_DOMAIN")
-	smtpServerDomain := getEnv("SMTP_SERVER_DOMAIN")
-	smtpServerPort := getEnv("SMTP_SERVER_PORT")
 	targetEmailAddress := getEnv("TARGET_EMAIL_ADDRESS")
 	sourceEmailAddress := getEnv("SOURCE_EMAIL_ADDRESS")
-	sourceEmailPassword := getEnv("SOURCE_EMAIL_PASSWORD")
-	skipTlsVerify := getEnv("TEST_ONLY_SKIP_TLS_VERIFY") == "dummy string just in case"
-
-	smtpMessageMutex := sync.Mutex{}
-
-	buildMessage := func(email *requestBody) string {
-		return fmt.Sprintf(
-			"To: %s\r\nSubject: %s\r\n\r\n%s\r\n\r\nSent by %s",
-			targetEmailAddress,
-			email.Subject,
-			email.Body,
-			email.Sender,
-		)
+	templates, err := loadTemplates(getEnv, emailTemplateName)
+	if err != nil {
+		return nil, err
 	}
-
-	setupSmtpClient := func() (client *smtp.Client, err error) {
-		server := &smtpServer{
-			Host: smtpServerDomain,
-			Port: smtpServerPort,
-		}
-		tlsConfig := &tls.Config{
-			InsecureSkipVerify: skipTlsVerify,
-			ServerName:         server.Host,
-		}
-		auth := smtp.PlainAuth("", sourceEmailAddress, sourceEmailPassword, server.Host)
-
-		log.Println("[DEBUG] Establishing TCP connection with SMTP server")
-		conn, err := net.Dial("tcp", server.Name())
-		if err != nil {
-			return
-		}
-		log.Println("[DEBUG] Creating SMTP client")
-		client, err = smtp.NewClient(conn, server.Host)
-		if err != nil {
-			return
-		}
-		log.Println("[DEBUG] Sending HELLO to SMTP server")
-		if err = client.Hello(smtpClientDomain); err != nil {
-			return
-		}
-		log.Println("[DEBUG] Negotiating TLS encryption for SMTP communication")
-		if err = client.StartTLS(tlsConfig); err != nil {
-			return
-		}
-		log.Println("[DEBUG] Authenticating to the SMTP server")
-		err = client.Auth(auth)
-		return
+	attachmentLimits := loadAttachmentLimits(getEnv)
+	redirectPolicy, err := loadRedirectPolicy(getEnv)
+	if err != nil {
+		return nil, err
 	}
-
-	cancelEmail := func(client *smtp.Client) (err error) {
-		log.Println("[DEBUG] Aborting SMTP email")
-		err = client.Reset()
+	formTokens := loadFormTokens(getEnv)
+	spamFilter, err := spam.New(getEnv)
+	if err != nil {
+		return nil, err
+	}
+	acknowledgements, err := loadAcknowledgements(getEnv)
+	if err != nil {
+		return nil, err
+	}
+	idempotency, err := loadIdempotencyGuard(getEnv)
+	if err != nil {
+		return nil, err
+	}
+	// Quarantined emails are written as .eml files, and tagged then forwarded if there is no quarantine.
+	var quarantine transport.Transport
+	if directory := getEnv("SPAM_QUARANTINE_DIRECTORY"); directory != "" {
+		quarantine, err = transport.NewFile(config.Override(getEnv, "MAIL_FILE_DIRECTORY", directory))
 		if err != nil {
-			return
+			return nil, err
 		}
-		return errCancelled
 	}
 
-	sendEmail := func(request *http.Request, client *smtp.Client, email *requestBody) (err error) {
-		doneChannel := make(chan struct{})
-		smtpMessageMutex.Lock()
-		defer smtpMessageMutex.Unlock()
-
-		log.Println("[DEBUG] Setting SMTP email sender")
-		go func() {
-			err = client.Mail(sourceEmailAddress)
-			doneChannel <- struct{}{}
-		}()
-		select {
-		case <-doneChannel:
-			if err != nil {
-				return
-			}
-		case <-request.Context().Done():
-			return cancelEmail(client)
-		}
-
-		log.Println("[DEBUG] Setting SMTP email receiver")
-		go func() {
-			err = client.Rcpt(targetEmailAddress)
-			doneChannel <- struct{}{}
-		}()
-		select {
-		case <-doneChannel:
-			if err != nil {
-				return
-			}
-		case <-request.Context().Done():
-			return cancelEmail(client)
-		}
-
-		log.Println("[DEBUG] Starting SMTP email body")
-		var messageWriter io.WriteCloser
-		go func() {
-			messageWriter, err = client.Data()
-			doneChannel <- struct{}{}
-		}()
-		select {
-		case <-doneChannel:
-			if err != nil {
-				return
-			}
-		case <-request.Context().Done():
-			return cancelEmail(client)
-		}
-
-		log.Println("[DEBUG] Writing SMTP email body")
-		go func() {
-			_, err = messageWriter.Write([]byte(buildMessage(email)))
-			doneChannel <- struct{}{}
-		}()
-		select {
-		case <-doneChannel:
-			if err != nil {
-				return
-			}
-		case <-request.Context().Done():
-			return cancelEmail(client)
-		}
-
-		log.Println("[DEBUG] Sending SMTP email")
-		go func() {
-			err = messageWriter.Close()
-			doneChannel <- struct{}{}
-		}()
-		select {
-		case <-doneChannel:
-			return
-		case <-request.Context().Done():
-			return cancelEmail(client)
+	buildMessage := func(email *requestBody, attachments []*transport.Attachment, request *http.Request) (*transport.Message, error) {
+		message := transport.NewMessage(sourceEmailAddress, []string{targetEmailAddress}, email.Subject, "")
+		message.ReplyTo = replyToAddress(email)
+		message.Attachments = attachments
+		attachmentNames := make([]string, len(attachments))
+		for i, attachment := range attachments {
+			attachmentNames[i] = attachment.Filename
 		}
+		html, text, err := templates.render(&templateData{
+			Sender:      email.Sender,
+			SenderEmail: email.SenderEmail,
+			Subject:     email.Subject,
+			Body:        email.Body,
+			ReceivedAt:  message.Date,
+			RemoteAddr:  request.RemoteAddr,
+			UserAgent:   request.UserAgent(),
+			Referer:     request.Referer(),
+			Attachments: attachmentNames,
+		})
+		message.Html = html
+		message.Text = text
+		return message, err
 	}
 
-	failPostEmail := func(response http.ResponseWriter, request *http.Request, email *requestBody, err error) {
+	failPostEmail := func(response http.ResponseWriter, request *http.Request, email *requestBody, problem *problemDetails, err error) {
 		log.Printf("[ERROR] POST /api/email failed for sender %q: %s\n", email.Sender, err)
 		failureRedirectUrl := fmt.Sprintf(
 			"mailto:%s?subject=%s&body=%s",
@@ -185,56 +108,163 @@ func HandlePostEmail(
 			url.PathEscape(email.Subject),
 			url.PathEscape(email.Body),
 		)
-		http.Redirect(response, request, failureRedirectUrl, http.StatusSeeOther)
+		if acceptsJson(request) {
+			problem.MailtoUrl = failureRedirectUrl
+			writeProblem(response, problem)
+		} else {
+			http.Redirect(response, request, failureRedirectUrl, http.StatusSeeOther)
+		}
 	}
 
-	var (
-		initSmtp     sync.Once
-		smtpClient   *smtp.Client
-		smtpSetupErr error
-	)
-
-	shutdownWaitGroup.Add(1)
-	listenForShutdown := func() {
-		<-appContext.Done()
-		if smtpClient != nil {
-			log.Println("[INFO] Shutting down SMTP client")
-			err := smtpClient.Quit()
+	succeedPostEmail := func(response http.ResponseWriter, request *http.Request, email *requestBody, message *transport.Message, acknowledgement string) {
+		if !acceptsJson(request) {
+			http.Redirect(response, request, redirectPolicy.resolve(email.SuccessRedirectUrl), http.StatusFound)
+		} else if transport.IsQueued(mailTransport) {
+			writeJson(response, http.StatusAccepted, "application/json", &successBody{Status: "queued", MessageId: message.Id, Acknowledgement: acknowledgement})
+		} else {
+			writeJson(response, http.StatusOK, "application/json", &successBody{Status: "sent", MessageId: message.Id, Acknowledgement: acknowledgement})
+		}
+	}
+
+	// deliverEmail processes valid submissions, which are sent unless blocked, or the CAPTCHA or spam checks fail.
+	// It reports whether the submission was handled for good, as opposed to failures which may be retried.
+	deliverEmail := func(response http.ResponseWriter, request *http.Request, email *requestBody, attachments []*transport.Attachment) (delivered bool) {
+		blocklistSubject := newBlocklistSubject(request, email)
+		// Like bots, blocked senders are answered as if their email was sent.
+		if match := senderBlocklist.Blocked(blocklistSubject); match != nil {
+			log.Printf("[WARN] POST /api/email dropped email from sender %q matching %s\n", email.Sender, match)
+			succeedPostEmail(response, request, email, transport.NewMessage(sourceEmailAddress, nil, "", ""), "")
+			return true
+		}
+		allowMatch := senderBlocklist.Allowed(blocklistSubject)
+		if allowMatch != nil {
+			log.Printf("[INFO] POST /api/email bypassing spam filter for sender %q matching %s\n", email.Sender, allowMatch)
+		}
+
+		if captchaVerifier != nil {
+			err := captchaVerifier.Verify(request.Context(), email.CaptchaToken, request.RemoteAddr)
 			if err != nil {
-				log.Printf("[ERROR] SMTP client shutdown failed: %s\n", err)
+				log.Printf("[WARN] POST /api/email failed CAPTCHA verification for sender %q: %s\n", email.Sender, err)
+				writeCaptchaProblem(response, request, err)
+				return false
 			}
 		}
-		shutdownWaitGroup.Done()
+
+		spamSubmission := newSpamSubmission(email)
+		spamResult := &spam.Result{}
+		if allowMatch == nil {
+			spamResult = spamFilter.Evaluate(spamSubmission)
+		}
+		if spamResult.Verdict == spam.Reject {
+			problem := newProblem(http.StatusUnprocessableEntity, "The email was classified as spam")
+			failPostEmail(response, request, email, problem, fmt.Errorf("spam filter: %s", spamResult))
+			return false
+		}
+		if spamResult.Verdict != spam.Accept {
+			log.Printf("[WARN] POST /api/email spam filter verdict for sender %q: %s\n", email.Sender, spamResult)
+		}
+
+		message, err := buildMessage(email, attachments, request)
+		if err != nil {
+			problem := newProblem(http.StatusInternalServerError, "The email could not be rendered")
+			failPostEmail(response, request, email, problem, err)
+			return false
+		}
+		if spamResult.Verdict == spam.Quarantine && quarantine != nil {
+			err = quarantine.Send(request.Context(), message)
+			if err == nil {
+				spamFilter.Remember(spamSubmission)
+				succeedPostEmail(response, request, email, message, "")
+				return true
+			}
+			log.Printf("[ERROR] Failed to quarantine email %s, forwarding it instead: %s\n", message.Id, err)
+		}
+		if spamResult.Verdict != spam.Accept {
+			message.Subject = "[SPAM] " + message.Subject
+		}
+		err = mailTransport.Send(request.Context(), message)
+		if err != nil {
+			problem := newProblem(http.StatusBadGateway, "The email could not be delivered")
+			problem.MessageId = message.Id
+			failPostEmail(response, request, email, problem, err)
+			return false
+		}
+		spamFilter.Remember(spamSubmission)
+		// Emails suspected of spam are not acknowledged, so that they cannot carry spam to third parties.
+		var acknowledgement string
+		if spamResult.Verdict == spam.Accept {
+			acknowledgement = acknowledgements.send(request.Context(), mailTransport, email, message.Date)
+		}
+		succeedPostEmail(response, request, email, message, acknowledgement)
+		return true
 	}
 
-	go listenForShutdown()
 	return func(response http.ResponseWriter, request *http.Request) {
-		decoder := json.NewDecoder(request.Body)
 		var email *requestBody
-		err := decoder.Decode(&email)
-		if err != nil {
-			http.Error(response, err.Error(), http.StatusBadRequest)
+		var attachments []*transport.Attachment
+		var requestErr *requestError
+		contentType := request.Header.Get("Content-Type")
+		if contentType == "" {
+			contentType = "application/json"
+		}
+		mediaType, _, _ := mime.ParseMediaType(contentType)
+		switch mediaType {
+		case "multipart/form-data":
+			email, attachments, requestErr = decodeMultipartForm(request, attachmentLimits)
+		case "application/x-www-form-urlencoded":
+			email, requestErr = decodeUrlEncodedForm(request)
+		case "application/json":
+			email, requestErr = decodeJson(request)
+		default:
+			requestErr = newRequestError(http.StatusUnsupportedMediaType, "", "unsupported_media_type", "must be one of "+strings.Join(supportedMediaTypes, ", "))
+		}
+		if requestErr != nil {
+			log.Printf("[WARN] POST /api/email rejected invalid request: %v\n", requestErr.fields)
+			writeValidationErrors(response, request, requestErr.status, requestErr.fields)
+			return
 		}
 
-		initSmtp.Do(func() {
-			log.Println("[INFO] Setting up SMTP client")
-			smtpClient, smtpSetupErr = setupSmtpClient()
-			if smtpSetupErr == nil {
-				log.Println("[INFO] SMTP client is ready")
-			} else {
-				log.Printf("[ERROR] SMTP client setup failed: %s\n", smtpSetupErr)
-			}
-		})
-		if smtpSetupErr != nil {
-			failPostEmail(response, request, email, smtpSetupErr)
+		// Bots are answered as if their email was sent, so that they learn nothing.
+		botReason, requestErr := formTokens.detectBot(email, time.Now())
+		if requestErr != nil {
+			log.Printf("[WARN] POST /api/email rejected invalid form token: %v\n", requestErr.fields)
+			writeValidationErrors(response, request, requestErr.status, requestErr.fields)
+			return
+		}
+		if botReason != "" {
+			log.Printf("[WARN] POST /api/email dropped email from %s, which %s\n", request.RemoteAddr, botReason)
+			succeedPostEmail(response, request, email, transport.NewMessage(sourceEmailAddress, nil, "", ""), "")
 			return
 		}
 
-		err = sendEmail(request, smtpClient, email)
-		if err == nil {
-			http.Redirect(response, request, email.SuccessRedirectUrl, http.StatusFound)
-		} else {
-			failPostEmail(response, request, email, err)
+		if errs := validateEmail(email); len(errs) > 0 {
+			log.Printf("[WARN] POST /api/email rejected invalid fields: %v\n", errs)
+			writeValidationErrors(response, request, http.StatusBadRequest, errs)
+			return
 		}
-	}
+
+		idempotent, requestErr := idempotency.identify(request, email, attachments)
+		if requestErr != nil {
+			log.Printf("[WARN] POST /api/email rejected invalid request: %v\n", requestErr.fields)
+			writeValidationErrors(response, request, requestErr.status, requestErr.fields)
+			return
+		}
+		if idempotent == nil {
+			deliverEmail(response, request, email, attachments)
+			return
+		}
+		previous, err := idempotency.claim(idempotent)
+		switch {
+		case err != nil:
+			log.Printf("[ERROR] Failed to check for duplicate submissions, processing the request anyway: %s\n", err)
+			deliverEmail(response, request, email, attachments)
+		case previous != nil:
+			log.Printf("[INFO] POST /api/email replaying the response to duplicate submission of sender %q\n", email.Sender)
+			idempotency.replay(response, request, idempotent, previous)
+		default:
+			recorder := &responseRecorder{ResponseWriter: response}
+			delivered := deliverEmail(recorder, request, email, attachments)
+			idempotency.complete(idempotent, recorder, delivered)
+		}
+	}, nil
 }
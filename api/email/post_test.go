@@ -3,22 +3,32 @@ package email
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
+	"mime"
+	"mime/multipart"
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/mail"
 	"net/url"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/mhale/smtpd"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"portfolio-back/transport"
 )
 
 const targetEmailAddress = "target@test.com"
@@ -30,13 +40,7 @@ const emailSubject = "Test subject"
 const emailBody = "Test body"
 const successRedirectUrl = "http://localhost/success"
 
-var expectedMessageReceived = fmt.Sprintf(
-	"To: %s\r\nSubject: %s\r\n\r\n%s\r\n\r\nSent by %s",
-	targetEmailAddress,
-	emailSubject,
-	emailBody,
-	emailSender,
-)
+var expectedSignatureReceived = fmt.Sprintf("Sent by %s", emailSender)
 var expectedErrorRedirectUrl = fmt.Sprintf(
 	"mailto:%s?subject=%s&body=%s",
 	targetEmailAddress,
@@ -50,7 +54,17 @@ func TestSendEmail(t *testing.T) {
 		emailsReceived++
 		assert.Equal(t, sourceEmailAddress, from)
 		assert.Equal(t, []string{targetEmailAddress}, to)
-		assert.Contains(t, string(data), expectedMessageReceived)
+		message, err := mail.ReadMessage(bytes.NewReader(data))
+		require.Nil(t, err, "Failed to parse email: %s\n", err)
+		assert.Equal(t, "<"+sourceEmailAddress+">", message.Header.Get("From"))
+		assert.Equal(t, "<"+targetEmailAddress+">", message.Header.Get("To"))
+		assert.Equal(t, emailSubject, message.Header.Get("Subject"))
+		parts := readAlternativeParts(t, message)
+		require.Len(t, parts, 2)
+		assert.True(t, strings.HasPrefix(parts["text/plain"], emailBody+"\r\n"))
+		assert.Contains(t, parts["text/plain"], expectedSignatureReceived)
+		assert.Contains(t, parts["text/html"], "<h1 style=\"margin: 0 0 16px; font-size: 20px;\">"+emailSubject+"</h1>")
+		assert.Contains(t, parts["text/html"], ">"+emailBody+"</div>")
 		return nil
 	}
 
@@ -115,6 +129,71 @@ func TestReuseSmtpConnection(t *testing.T) {
 	assert.Equal(t, 1, connSetupCount)
 }
 
+func TestReconnectAfterIdleConnectionDropped(t *testing.T) {
+	var connSetupCount atomic.Uint32
+	smtpAuthHandler := func(_ net.Addr, _ string, _ []byte, _ []byte, _ []byte) (bool, error) {
+		connSetupCount.Add(1)
+		return true, nil
+	}
+
+	smtpServer := newSmtpServer(t, nil, smtpAuthHandler)
+	smtpServer.Timeout = 50 * time.Millisecond
+	smtpListener, smtpServerPort := newSmtpServerListener()
+	go serveSmtp(smtpServer, smtpListener)
+	defer teardownSmtpServer(smtpServer)
+	testHttpServer, shutdownWaitGroup, triggerShutdown := setupHttpServer(context.Background(), smtpServerPort)
+	defer teardownHttpServer(testHttpServer, shutdownWaitGroup, triggerShutdown)
+
+	requestPostEmail(t, testHttpServer.URL)
+	time.Sleep(4 * smtpServer.Timeout)
+	response := requestPostEmail(t, testHttpServer.URL)
+	assert.Equal(t, http.StatusFound, response.StatusCode)
+	assert.Equal(t, 2, int(connSetupCount.Load()))
+}
+
+func TestRedialAfterFailedSetup(t *testing.T) {
+	smtpListener, smtpServerPort := newSmtpServerListener()
+	smtpListener.Close()
+	testHttpServer, shutdownWaitGroup, triggerShutdown := setupHttpServer(context.Background(), smtpServerPort)
+	defer teardownHttpServer(testHttpServer, shutdownWaitGroup, triggerShutdown)
+
+	response := requestPostEmail(t, testHttpServer.URL)
+	assert.Equal(t, http.StatusSeeOther, response.StatusCode)
+
+	smtpServer := newSmtpServer(t, nil, nil)
+	smtpListener, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", smtpServerPort))
+	require.Nil(t, err, "Failed to start TCP listener for SMTP server: %s\n", err)
+	go serveSmtp(smtpServer, smtpListener)
+	defer teardownSmtpServer(smtpServer)
+
+	response = requestPostEmail(t, testHttpServer.URL)
+	assert.Equal(t, http.StatusFound, response.StatusCode)
+}
+
+func TestAuthMechanisms(t *testing.T) {
+	for _, mechanism := range []string{"PLAIN", "LOGIN", "CRAM-MD5"} {
+		t.Run(mechanism, func(t *testing.T) {
+			usedMechanism := ""
+			smtpAuthHandler := func(remoteAddr net.Addr, mechanism string, username []byte, password []byte, shared []byte) (bool, error) {
+				usedMechanism = mechanism
+				return defaultSmtpAuthHandlerfunc(t)(remoteAddr, mechanism, username, password, shared)
+			}
+
+			smtpServer := newSmtpServer(t, nil, smtpAuthHandler)
+			smtpServer.AuthMechs = map[string]bool{"PLAIN": false, "LOGIN": false, "CRAM-MD5": false, mechanism: true}
+			smtpListener, smtpServerPort := newSmtpServerListener()
+			go serveSmtp(smtpServer, smtpListener)
+			defer teardownSmtpServer(smtpServer)
+			testHttpServer, shutdownWaitGroup, triggerShutdown := setupHttpServer(context.Background(), smtpServerPort)
+			defer teardownHttpServer(testHttpServer, shutdownWaitGroup, triggerShutdown)
+
+			response := requestPostEmail(t, testHttpServer.URL)
+			assert.Equal(t, http.StatusFound, response.StatusCode)
+			assert.Equal(t, mechanism, usedMechanism)
+		})
+	}
+}
+
 func TestCancellation(t *testing.T) {
 	smtpRequestReceived := make(chan struct{})
 	unlockSmtpServer := make(chan struct{})
@@ -173,6 +252,39 @@ func TestConcurrentRequests(t *testing.T) {
 	assert.Equal(t, concurrentRequests, int(emailsReceived.Load()))
 }
 
+func TestConcurrentRequestsAreNotSerialized(t *testing.T) {
+	concurrentRequests := 2
+	smtpRequestReceived := make(chan struct{})
+	unlockSmtpServer := make(chan struct{})
+	smtpHandler := func(_ net.Addr, _ string, _ []string, _ []byte) error {
+		smtpRequestReceived <- struct{}{}
+		<-unlockSmtpServer
+		return nil
+	}
+
+	smtpServer, smtpServerPort := setupSmtpServer(t, smtpHandler, nil)
+	defer teardownSmtpServer(smtpServer)
+	testHttpServer, shutdownWaitGroup, triggerShutdown := setupHttpServer(context.Background(), smtpServerPort)
+	defer teardownHttpServer(testHttpServer, shutdownWaitGroup, triggerShutdown)
+
+	httpRequestCompleted := make(chan struct{})
+	for range concurrentRequests {
+		go func() {
+			response := requestPostEmail(t, testHttpServer.URL)
+			assert.Equal(t, http.StatusFound, response.StatusCode)
+			httpRequestCompleted <- struct{}{}
+		}()
+	}
+
+	for range concurrentRequests {
+		<-smtpRequestReceived
+	}
+	close(unlockSmtpServer)
+	for range concurrentRequests {
+		<-httpRequestCompleted
+	}
+}
+
 func setupSmtpServer(t *testing.T, handler smtpd.Handler, authHandler smtpd.AuthHandler) (*smtpd.Server, int) {
 	smtpServer := newSmtpServer(t, handler, authHandler)
 	smtpListener, smtpServerPort := newSmtpServerListener()
@@ -183,7 +295,15 @@ func setupSmtpServer(t *testing.T, handler smtpd.Handler, authHandler smtpd.Auth
 func setupHttpServer(appContext context.Context, smtpServerPort int) (*httptest.Server, *sync.WaitGroup, func()) {
 	httpServerContext, triggerShutdown := context.WithCancel(appContext)
 	shutdownWaitGroup := &sync.WaitGroup{}
-	handleEmail := HandlePostEmail(httpServerContext, shutdownWaitGroup, mockGetEnvWithServerPort(smtpServerPort))
+	getEnv := mockGetEnvWithServerPort(smtpServerPort)
+	mailTransport, err := transport.New(httpServerContext, shutdownWaitGroup, getEnv)
+	if err != nil {
+		log.Panicf("Failed to set up mail transport: %s\n", err)
+	}
+	handleEmail, err := HandlePostEmail(mailTransport, nil, nil, getEnv)
+	if err != nil {
+		log.Panicf("Failed to set up email handler: %s\n", err)
+	}
 	httpEmailHandler := http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
 		request = request.WithContext(appContext)
 		handleEmail(response, request)
@@ -209,10 +329,18 @@ func newSmtpServer(t *testing.T, handler smtpd.Handler, authHandler smtpd.AuthHa
 }
 
 func defaultSmtpAuthHandlerfunc(t *testing.T) smtpd.AuthHandler {
-	return func(_ net.Addr, mechanism string, username []byte, password []byte, _ []byte) (bool, error) {
-		assert.Equal(t, "PLAIN", mechanism)
+	return func(_ net.Addr, mechanism string, username []byte, password []byte, shared []byte) (bool, error) {
 		assert.Equal(t, sourceEmailAddress, string(username))
-		assert.Equal(t, sourceEmailPassword, string(password))
+		switch mechanism {
+		case "PLAIN", "LOGIN":
+			assert.Equal(t, sourceEmailPassword, string(password))
+		case "CRAM-MD5":
+			expectedDigest := hmac.New(md5.New, []byte(sourceEmailPassword))
+			expectedDigest.Write(shared)
+			assert.Equal(t, hex.EncodeToString(expectedDigest.Sum(nil)), string(password))
+		default:
+			assert.Fail(t, "Unexpected SMTP authentication mechanism", mechanism)
+		}
 		return true, nil
 	}
 }
@@ -234,25 +362,22 @@ func serveSmtp(server *smtpd.Server, listener net.Listener) {
 }
 
 func mockGetEnvWithServerPort(smtpServerPort int) func(string) string {
-	return func(key string) string {
-		switch key {
-		case "SMTP_CLIENT_DOMAIN":
-			return "localhost"
-		case "SMTP_SERVER_DOMAIN":
-			return "localhost"
-		case "SMTP_SERVER_PORT":
-			return fmt.Sprint(smtpServerPort)
-		case "TARGET_EMAIL_ADDRESS":
-			return targetEmailAddress
-		case "SOURCE_EMAIL_ADDRESS":
-			return sourceEmailAddress
-		case "SOURCE_EMAIL_PASSWORD":
-			return sourceEmailPassword
-		case "TEST_ONLY_SKIP_TLS_VERIFY":
-			return "dummy string just in case"
-		default:
-			return ""
-		}
+	return mockGetEnv(newTestEnv(smtpServerPort))
+}
+
+// newTestEnv is the configuration shared by the handler tests, to which they may add.
+func newTestEnv(smtpServerPort int) map[string]string {
+	return map[string]string{
+		"SMTP_CLIENT_DOMAIN":             "localhost",
+		"SMTP_SERVER_DOMAIN":             "localhost",
+		"SMTP_SERVER_PORT":               fmt.Sprint(smtpServerPort),
+		"TARGET_EMAIL_ADDRESS":           targetEmailAddress,
+		"SOURCE_EMAIL_ADDRESS":           sourceEmailAddress,
+		"SOURCE_EMAIL_PASSWORD":          sourceEmailPassword,
+		"SMTP_DIAL_BACKOFF":              "1",
+		"SMTP_TLS_CA_FILE":               "../../smtp_test_server.crt",
+		"REDIRECT_ALLOWLIST":             "http://localhost",
+		"IDEMPOTENCY_FINGERPRINT_WINDOW": "0",
 	}
 }
 
@@ -281,6 +406,28 @@ func newHttpClientNoRedirects() *http.Client {
 	}
 }
 
+// readAlternativeParts decodes the parts of a multipart/alternative email, by media type.
+func readAlternativeParts(t *testing.T, message *mail.Message) map[string]string {
+	mediaType, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+	require.Nil(t, err, "Failed to parse email content type: %s\n", err)
+	require.Equal(t, "multipart/alternative", mediaType)
+	parts := map[string]string{}
+	reader := multipart.NewReader(message.Body, params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return parts
+		}
+		require.Nil(t, err, "Failed to read email part: %s\n", err)
+		partMediaType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		require.Nil(t, err, "Failed to parse email part content type: %s\n", err)
+		// The multipart reader transparently decodes quoted-printable parts
+		content, err := io.ReadAll(part)
+		require.Nil(t, err, "Failed to decode email part: %s\n", err)
+		parts[partMediaType] = string(content)
+	}
+}
+
 func newPostBody() io.Reader {
 	requestBody := &requestBody{
 		Sender:             emailSender,
@@ -0,0 +1,109 @@
+package email
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// redirectPolicy only lets visitors be redirected to the allowed origins and path prefixes,
+// so that the endpoint cannot be abused as an open redirector.
+type redirectPolicy struct {
+	allowed    []*url.URL
+	defaultUrl string
+}
+
+// loadRedirectPolicy reads REDIRECT_ALLOWLIST, made of absolute URLs allowing their origin
+// and path prefix, or of paths allowing relative redirects.
+func loadRedirectPolicy(getEnv func(string) string) (*redirectPolicy, error) {
+	policy := &redirectPolicy{defaultUrl: getEnv("REDIRECT_DEFAULT_URL")}
+	if policy.defaultUrl == "" {
+		policy.defaultUrl = "/"
+	}
+	for _, entry := range strings.Split(getEnv("REDIRECT_ALLOWLIST"), ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		allowed, err := parseRedirectUrl(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDIRECT_ALLOWLIST entry %q: %w", entry, err)
+		}
+		policy.allowed = append(policy.allowed, allowed)
+	}
+	return policy, nil
+}
+
+// resolve returns the URL to redirect to, which is the default one unless the requested URL is allowed.
+func (policy *redirectPolicy) resolve(rawUrl string) string {
+	if rawUrl == "" {
+		return policy.defaultUrl
+	}
+	requested, err := parseRedirectUrl(rawUrl)
+	if err == nil {
+		for _, allowed := range policy.allowed {
+			if matchesRedirect(requested, allowed) {
+				return requested.String()
+			}
+		}
+		err = fmt.Errorf("not allowed")
+	}
+	log.Printf("[WARN] Rejected redirect URL %q: %s\n", rawUrl, err)
+	return policy.defaultUrl
+}
+
+// parseRedirectUrl only accepts absolute HTTP(S) URLs without credentials, and paths.
+// Inputs which browsers may interpret differently from url.Parse are rejected outright.
+func parseRedirectUrl(rawUrl string) (*url.URL, error) {
+	if strings.ContainsFunc(rawUrl, func(char rune) bool {
+		return char == '\\' || char <= ' ' || char == 0x7f
+	}) {
+		return nil, fmt.Errorf("contains backslashes, whitespace or control characters")
+	}
+	parsed, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Opaque != "" || parsed.User != nil {
+		return nil, fmt.Errorf("must not contain credentials")
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https":
+		if parsed.Host == "" {
+			return nil, fmt.Errorf("must have a host")
+		}
+	case "":
+		if parsed.Host != "" || !strings.HasPrefix(parsed.Path, "/") {
+			return nil, fmt.Errorf("must be an absolute URL or a path starting with a single slash")
+		}
+	default:
+		return nil, fmt.Errorf("must use the http or https scheme")
+	}
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+	return parsed, nil
+}
+
+func matchesRedirect(requested *url.URL, allowed *url.URL) bool {
+	if requested.Scheme != allowed.Scheme || hostWithPort(requested) != hostWithPort(allowed) {
+		return false
+	}
+	allowedPath := path.Clean("/" + allowed.Path)
+	requestedPath := path.Clean("/" + requested.Path)
+	return allowedPath == "/" || requestedPath == allowedPath || strings.HasPrefix(requestedPath, strings.TrimSuffix(allowedPath, "/")+"/")
+}
+
+// hostWithPort makes default ports explicit, so that https://example.com matches https://example.com:443.
+func hostWithPort(parsed *url.URL) string {
+	if parsed.Host == "" {
+		return ""
+	}
+	port := parsed.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[parsed.Scheme]
+	}
+	return net.JoinHostPort(parsed.Hostname(), port)
+}
@@ -0,0 +1,89 @@
+package email
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// problemDetails describes an error as per RFC 9457.
+type problemDetails struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+
+	Errors    []fieldError `json:"errors,omitempty"`
+	MessageId string       `json:"messageId,omitempty"`
+	// Lets the visitor send the email from their own mail client instead.
+	MailtoUrl string `json:"mailtoUrl,omitempty"`
+}
+
+type successBody struct {
+	// Either "sent", or "queued" when the email is delivered asynchronously.
+	Status    string `json:"status"`
+	MessageId string `json:"messageId"`
+	// Outcome of the acknowledgement sent to the visitor, if any: "sent", "queued", "throttled" or "failed".
+	Acknowledgement string `json:"acknowledgement,omitempty"`
+}
+
+// acceptsJson reports whether the client explicitly asks for JSON,
+// as opposed to browsers submitting forms, which expect redirects.
+func acceptsJson(request *http.Request) bool {
+	for _, mediaRange := range strings.Split(request.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(mediaRange)
+		if err != nil {
+			continue
+		}
+		if quality, isWeighted := params["q"]; isWeighted {
+			if weight, err := strconv.ParseFloat(quality, 64); err != nil || weight <= 0 {
+				continue
+			}
+		}
+		if mediaType == "application/json" || mediaType == "application/problem+json" {
+			return true
+		}
+	}
+	return false
+}
+
+func newProblem(status int, detail string) *problemDetails {
+	return &problemDetails{Type: "about:blank", Title: http.StatusText(status), Status: status, Detail: detail}
+}
+
+func writeProblem(response http.ResponseWriter, problem *problemDetails) {
+	writeJson(response, problem.Status, "application/problem+json", problem)
+}
+
+// writeError answers API clients with the problem, and browsers with its plain text,
+// as they cannot follow up on problem details.
+func writeError(response http.ResponseWriter, request *http.Request, problem *problemDetails) {
+	if acceptsJson(request) {
+		writeProblem(response, problem)
+		return
+	}
+	var text strings.Builder
+	text.WriteString(problem.Detail)
+	for _, err := range problem.Errors {
+		text.WriteString("\n")
+		if err.Field != "" {
+			text.WriteString(err.Field + " ")
+		}
+		text.WriteString(err.Message)
+	}
+	http.Error(response, text.String(), problem.Status)
+}
+
+func writeValidationErrors(response http.ResponseWriter, request *http.Request, status int, errs []fieldError) {
+	problem := newProblem(status, "The request is invalid")
+	problem.Errors = errs
+	writeError(response, request, problem)
+}
+
+func writeJson(response http.ResponseWriter, status int, contentType string, body any) {
+	response.Header().Set("Content-Type", contentType)
+	response.WriteHeader(status)
+	json.NewEncoder(response).Encode(body)
+}
@@ -0,0 +1,104 @@
+package email
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"portfolio-back/transport"
+)
+
+func TestAcceptsJson(t *testing.T) {
+	for accept, expected := range map[string]bool{
+		"":                                  false,
+		"application/json":                  true,
+		"application/problem+json":          true,
+		"text/html, application/json;q=0.9": true,
+		"application/json;q=0":              false,
+		"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8": false,
+	} {
+		request := httptest.NewRequest(http.MethodPost, "/api/email", nil)
+		request.Header.Set("Accept", accept)
+		assert.Equal(t, expected, acceptsJson(request), "Unexpected negotiation for %q", accept)
+	}
+}
+
+func TestRespondWithJsonOnSuccess(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	response := postJson(t, newTestHandler(t, mailTransport, nil), newTestRequestBody(emailSubject, emailSender), acceptJson)
+
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "application/json", response.Header().Get("Content-Type"))
+	var body successBody
+	require.Nil(t, json.NewDecoder(response.Body).Decode(&body))
+	assert.Equal(t, successBody{Status: "sent", MessageId: mailTransport.lastMessage().Id}, body)
+}
+
+func TestRespondWithJsonWhenQueued(t *testing.T) {
+	next := &fakeTransport{}
+	outbox, err := transport.NewOutbox(next, mockGetEnv(map[string]string{"OUTBOX_DIRECTORY": t.TempDir()}))
+	require.Nil(t, err, "Failed to create outbox: %s\n", err)
+	defer outbox.Close()
+	response := postJson(t, newTestHandler(t, outbox, nil), newTestRequestBody(emailSubject, emailSender), acceptJson)
+
+	assert.Equal(t, http.StatusAccepted, response.Code)
+	var body successBody
+	require.Nil(t, json.NewDecoder(response.Body).Decode(&body))
+	assert.Equal(t, "queued", body.Status)
+	assert.NotEmpty(t, body.MessageId)
+}
+
+func TestRespondWithProblemOnFailure(t *testing.T) {
+	response := postJson(t, newTestHandler(t, &fakeTransport{failing: true}, nil), newTestRequestBody(emailSubject, emailSender), acceptJson)
+
+	assert.Equal(t, http.StatusBadGateway, response.Code)
+	assert.Equal(t, "application/problem+json", response.Header().Get("Content-Type"))
+	var body problemDetails
+	require.Nil(t, json.NewDecoder(response.Body).Decode(&body))
+	assert.Equal(t, "about:blank", body.Type)
+	assert.Equal(t, "Bad Gateway", body.Title)
+	assert.Equal(t, http.StatusBadGateway, body.Status)
+	assert.Equal(t, expectedErrorRedirectUrl, body.MailtoUrl)
+	assert.NotEmpty(t, body.MessageId)
+}
+
+func TestRespondWithProblemOnInvalidFields(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	response := postJson(t, newTestHandler(t, mailTransport, nil), newTestRequestBody("Hello\r\nBcc: attacker@test.com", emailSender), acceptJson)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, "application/problem+json", response.Header().Get("Content-Type"))
+	var body problemDetails
+	require.Nil(t, json.NewDecoder(response.Body).Decode(&body))
+	assert.Equal(t, http.StatusBadRequest, body.Status)
+	assert.Equal(t, "Subject", body.Errors[0].Field)
+}
+
+func TestRespondWithTextToBrowsersOnInvalidFields(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	form := "Subject=Test+subject&Body=Test+body"
+	browserHeader := http.Header{"Accept": {"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"}}
+	response := post(newTestHandler(t, mailTransport, nil), "application/x-www-form-urlencoded", form, browserHeader)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", response.Header().Get("Content-Type"))
+	assert.Equal(t, "The request is invalid\nSender is required\n", response.Body.String())
+	assert.Nil(t, mailTransport.lastMessage())
+}
+
+func TestRedirectBrowserFormPosts(t *testing.T) {
+	for mailTransport, expectedLocation := range map[transport.Transport]string{
+		&fakeTransport{}:              successRedirectUrl,
+		&fakeTransport{failing: true}: expectedErrorRedirectUrl,
+	} {
+		form := "Sender=Test+sender&Subject=Test+subject&Body=Test+body&SuccessRedirectUrl=http%3A%2F%2Flocalhost%2Fsuccess"
+		browserHeader := http.Header{"Accept": {"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"}}
+		response := post(newTestHandler(t, mailTransport, nil), "application/x-www-form-urlencoded", form, browserHeader)
+
+		assert.Equal(t, expectedLocation, response.Header().Get("Location"))
+	}
+}
@@ -0,0 +1,15 @@
+package email
+
+import (
+	"portfolio-back/spam"
+)
+
+// newSpamSubmission describes the submission to the spam filter.
+func newSpamSubmission(email *requestBody) *spam.Submission {
+	return &spam.Submission{
+		Sender:      email.Sender,
+		SenderEmail: email.SenderEmail,
+		Subject:     email.Subject,
+		Body:        email.Body,
+	}
+}
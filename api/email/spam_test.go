@@ -0,0 +1,62 @@
+package email
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplySpamVerdicts(t *testing.T) {
+	quarantineDirectory := t.TempDir()
+	env := map[string]string{
+		"SPAM_KEYWORDS":             "casino,pills,crypto",
+		"SPAM_KEYWORDS_SCORE":       "5",
+		"SPAM_QUARANTINE_DIRECTORY": quarantineDirectory,
+	}
+	for body, expected := range map[string]struct {
+		status           int
+		forwardedSubject string
+	}{
+		"Hello there":              {status: http.StatusOK, forwardedSubject: emailSubject},
+		"Visit my casino":          {status: http.StatusOK, forwardedSubject: "[SPAM] " + emailSubject},
+		"Casino and pills":         {status: http.StatusOK},
+		"Casino, pills and crypto": {status: http.StatusUnprocessableEntity},
+	} {
+		mailTransport := &fakeTransport{}
+		email := newTestRequestBody(emailSubject, emailSender)
+		email.Body = body
+		response := postJson(t, newTestHandler(t, mailTransport, env), email, acceptJson)
+
+		assert.Equal(t, expected.status, response.Code, "Unexpected status for %q", body)
+		if expected.forwardedSubject != "" {
+			require.NotNil(t, mailTransport.lastMessage(), "Email was not forwarded for %q", body)
+			assert.Equal(t, expected.forwardedSubject, mailTransport.lastMessage().Subject)
+		} else {
+			assert.Nil(t, mailTransport.lastMessage(), "Email was forwarded for %q", body)
+		}
+	}
+
+	quarantined, err := filepath.Glob(filepath.Join(quarantineDirectory, "*.eml"))
+	require.Nil(t, err)
+	assert.Len(t, quarantined, 1)
+}
+
+func TestRetryFailedDeliveryWithoutDuplicateScore(t *testing.T) {
+	mailTransport := &fakeTransport{failing: true}
+	handlePostEmail := newTestHandler(t, mailTransport, map[string]string{"SPAM_DUPLICATE_SCORE": "5"})
+	email := newTestRequestBody(emailSubject, emailSender)
+	failed := postJson(t, handlePostEmail, email, acceptJson)
+	require.Equal(t, http.StatusBadGateway, failed.Code)
+
+	mailTransport.failing = false
+	retried := postJson(t, handlePostEmail, email, acceptJson)
+	require.Equal(t, http.StatusOK, retried.Code)
+	assert.Equal(t, emailSubject, mailTransport.lastMessage().Subject)
+
+	duplicate := postJson(t, handlePostEmail, email, acceptJson)
+	require.Equal(t, http.StatusOK, duplicate.Code)
+	assert.Equal(t, "[SPAM] "+emailSubject, mailTransport.lastMessage().Subject)
+}
@@ -0,0 +1,90 @@
+package email
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+const (
+	emailTemplateName           = "email"
+	acknowledgementTemplateName = "acknowledgement"
+	htmlTemplateExtension       = ".html.tmpl"
+	textTemplateExtension       = ".txt.tmpl"
+)
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// templateData is what the email templates are rendered with.
+type templateData struct {
+	Sender      string
+	SenderEmail string
+	Subject     string
+	Body        string
+	ReceivedAt  time.Time
+	RemoteAddr  string
+	UserAgent   string
+	Referer     string
+	Attachments []string
+}
+
+type emailTemplates struct {
+	html *htmltemplate.Template
+	text *texttemplate.Template
+}
+
+// loadTemplates parses the HTML and text templates of the given name from EMAIL_TEMPLATES_DIRECTORY,
+// or the embedded ones by default.
+// The templates are rendered once with sample data, so that mistakes surface at startup.
+func loadTemplates(getEnv func(string) string, name string) (*emailTemplates, error) {
+	var templateFs fs.FS
+	if directory := getEnv("EMAIL_TEMPLATES_DIRECTORY"); directory != "" {
+		templateFs = os.DirFS(directory)
+	} else {
+		templateFs, _ = fs.Sub(embeddedTemplates, "templates")
+	}
+
+	html, err := htmltemplate.ParseFS(templateFs, name+htmlTemplateExtension)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTML %s template: %w", name, err)
+	}
+	text, err := texttemplate.ParseFS(templateFs, name+textTemplateExtension)
+	if err != nil {
+		return nil, fmt.Errorf("invalid text %s template: %w", name, err)
+	}
+	templates := &emailTemplates{html: html, text: text}
+
+	_, _, err = templates.render(&templateData{
+		Sender:      "Jane Doe",
+		SenderEmail: "jane@example.com",
+		Subject:     "Hello",
+		Body:        "Hello there",
+		ReceivedAt:  time.Now(),
+		RemoteAddr:  "192.0.2.1:1234",
+		UserAgent:   "Mozilla/5.0",
+		Referer:     "https://example.com/contact",
+		Attachments: []string{"resume.pdf"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return templates, nil
+}
+
+func (templates *emailTemplates) render(data *templateData) (html string, text string, err error) {
+	var htmlBuffer, textBuffer bytes.Buffer
+	if err = templates.html.Execute(&htmlBuffer, data); err != nil {
+		return "", "", fmt.Errorf("failed to render HTML email template: %w", err)
+	}
+	if err = templates.text.Execute(&textBuffer, data); err != nil {
+		return "", "", fmt.Errorf("failed to render text email template: %w", err)
+	}
+	return htmlBuffer.String(), strings.TrimRight(textBuffer.String(), "\n"), nil
+}
@@ -0,0 +1,72 @@
+package email
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderEmbeddedTemplates(t *testing.T) {
+	templates, err := loadTemplates(mockGetEnv(nil), emailTemplateName)
+	require.Nil(t, err, "Failed to load templates: %s\n", err)
+
+	html, text, err := templates.render(&templateData{
+		Sender:      "Jane <script>",
+		SenderEmail: "jane@test.com",
+		Subject:     "Hello",
+		Body:        "<b>Hi</b>",
+		ReceivedAt:  time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC),
+		RemoteAddr:  "192.0.2.1:1234",
+		UserAgent:   "Test agent",
+		Referer:     "https://test.com/contact",
+	})
+	require.Nil(t, err, "Failed to render templates: %s\n", err)
+	assert.Contains(t, html, "&lt;b&gt;Hi&lt;/b&gt;")
+	assert.Contains(t, html, "Jane &lt;script&gt;")
+	assert.Contains(t, html, "Sat, 01 Jun 2024 12:00:00 UTC")
+	assert.Contains(t, html, "https://test.com/contact")
+	assert.Equal(t, "<b>Hi</b>\n\n--\n"+
+		"Sent by Jane <script> <jane@test.com> on Sat, 01 Jun 2024 12:00:00 UTC\n"+
+		"Subject: Hello\n"+
+		"Client: 192.0.2.1:1234, Test agent\n"+
+		"Page: https://test.com/contact", text)
+}
+
+func TestLoadTemplatesFromDirectory(t *testing.T) {
+	directory := writeTemplates(t, "<p>{{.Body}}</p>", "{{.Body}} from {{.Sender}}\n")
+	templates, err := loadTemplates(mockGetEnv(map[string]string{"EMAIL_TEMPLATES_DIRECTORY": directory}), emailTemplateName)
+	require.Nil(t, err, "Failed to load templates: %s\n", err)
+
+	html, text, err := templates.render(&templateData{Sender: "Jane", Body: "Hi"})
+	require.Nil(t, err, "Failed to render templates: %s\n", err)
+	assert.Equal(t, "<p>Hi</p>", html)
+	assert.Equal(t, "Hi from Jane", text)
+}
+
+func TestLoadTemplatesFailsFast(t *testing.T) {
+	for name, directory := range map[string]string{
+		"syntax error":     writeTemplates(t, "<p>{{.Body}</p>", "{{.Body}}"),
+		"unknown field":    writeTemplates(t, "<p>{{.Body}}</p>", "{{.Phone}}"),
+		"missing template": t.TempDir(),
+	} {
+		_, err := loadTemplates(mockGetEnv(map[string]string{"EMAIL_TEMPLATES_DIRECTORY": directory}), emailTemplateName)
+		assert.NotNil(t, err, "Loaded templates despite %s", name)
+	}
+}
+
+func TestHandlePostEmailFailsOnInvalidTemplates(t *testing.T) {
+	directory := writeTemplates(t, "{{if}}", "{{.Body}}")
+	_, err := HandlePostEmail(&fakeTransport{}, nil, nil, mockGetEnv(map[string]string{"EMAIL_TEMPLATES_DIRECTORY": directory}))
+	assert.NotNil(t, err)
+}
+
+func writeTemplates(t *testing.T, html string, text string) string {
+	directory := t.TempDir()
+	require.Nil(t, os.WriteFile(filepath.Join(directory, emailTemplateName+htmlTemplateExtension), []byte(html), 0o600))
+	require.Nil(t, os.WriteFile(filepath.Join(directory, emailTemplateName+textTemplateExtension), []byte(text), 0o600))
+	return directory
+}
@@ -0,0 +1,179 @@
+package email
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxSubjectLength = 200
+	maxSenderLength  = 100
+	// As per RFC 5321, including the display name would not fit in a forward path anyway.
+	maxSenderEmailLength = 254
+	maxBodyLength        = 10000
+	maxRedirectUrlLength = 2048
+	// Tokens of CAPTCHA providers are opaque, and some exceed 2000 characters.
+	maxCaptchaTokenLength = 4096
+)
+
+// fieldError reports a violation, with a code which the frontend can map to its own messages.
+type fieldError struct {
+	// Empty when the violation concerns the request as a whole.
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// requestError rejects a request, pointing at the offending fields.
+type requestError struct {
+	status int
+	fields []fieldError
+}
+
+func newRequestError(status int, field string, code string, message string) *requestError {
+	return &requestError{status: status, fields: []fieldError{{Field: field, Code: code, Message: message}}}
+}
+
+type fieldRule struct {
+	name      string
+	value     func(email *requestBody) string
+	required  bool
+	minLength int
+	maxLength int
+	// Header-bound fields must not contain line breaks, which could inject headers.
+	isHeader bool
+	// Checks the format of non-empty values, once they passed the other rules.
+	checkFormat func(value string) (code string, message string)
+}
+
+var fieldRules = []*fieldRule{
+	{
+		name:      "Sender",
+		value:     func(email *requestBody) string { return email.Sender },
+		required:  true,
+		minLength: 2,
+		maxLength: maxSenderLength,
+		isHeader:  true,
+	},
+	{
+		name:      "SenderEmail",
+		value:     func(email *requestBody) string { return email.SenderEmail },
+		maxLength: maxSenderEmailLength,
+		isHeader:  true,
+		checkFormat: func(value string) (string, string) {
+			if _, err := mail.ParseAddress(value); err != nil {
+				return "invalid_email", "must be a valid email address"
+			}
+			return "", ""
+		},
+	},
+	{
+		name:      "Subject",
+		value:     func(email *requestBody) string { return email.Subject },
+		required:  true,
+		minLength: 2,
+		maxLength: maxSubjectLength,
+		isHeader:  true,
+	},
+	{
+		name:      "Body",
+		value:     func(email *requestBody) string { return email.Body },
+		required:  true,
+		minLength: 2,
+		maxLength: maxBodyLength,
+	},
+	{
+		name:      "SuccessRedirectUrl",
+		value:     func(email *requestBody) string { return email.SuccessRedirectUrl },
+		maxLength: maxRedirectUrlLength,
+		isHeader:  true,
+	},
+	{
+		// Bots filling the honeypot are dropped before validation, so that they get no feedback.
+		name:      "Website",
+		value:     func(email *requestBody) string { return email.Website },
+		maxLength: maxFormFieldSize,
+	},
+	{
+		name:      "FormToken",
+		value:     func(email *requestBody) string { return email.FormToken },
+		maxLength: maxFormTokenLength,
+		isHeader:  true,
+	},
+	{
+		name:      "CaptchaToken",
+		value:     func(email *requestBody) string { return email.CaptchaToken },
+		maxLength: maxCaptchaTokenLength,
+		isHeader:  true,
+	},
+}
+
+// validateEmail reports every violation at once, at most one per field.
+// Header-bound fields are checked so that they can neither inject headers nor break the message structure.
+func validateEmail(email *requestBody) []fieldError {
+	var errs []fieldError
+	for _, rule := range fieldRules {
+		if code, message := rule.validate(rule.value(email)); code != "" {
+			errs = append(errs, fieldError{Field: rule.name, Code: code, Message: message})
+		}
+	}
+	return errs
+}
+
+func (rule *fieldRule) validate(value string) (code string, message string) {
+	if strings.TrimSpace(value) == "" {
+		if rule.required {
+			return "required", "is required"
+		}
+		return "", ""
+	}
+	if !utf8.ValidString(value) {
+		return "invalid_utf8", "must be valid UTF-8"
+	}
+	if rule.isHeader && strings.IndexFunc(value, isForbiddenInHeader) >= 0 {
+		return "control_characters", "must not contain control characters or line breaks"
+	}
+	if !rule.isHeader && strings.IndexFunc(value, isForbiddenInText) >= 0 {
+		return "control_characters", "must not contain control characters"
+	}
+	length := utf8.RuneCountInString(value)
+	if length < rule.minLength {
+		return "too_short", fmt.Sprintf("must be at least %d characters long", rule.minLength)
+	}
+	if length > rule.maxLength {
+		return "too_long", fmt.Sprintf("must not exceed %d characters", rule.maxLength)
+	}
+	if rule.checkFormat != nil {
+		return rule.checkFormat(value)
+	}
+	return "", ""
+}
+
+// replyToAddress parses the validated sender email, which defaults its display name to the sender.
+func replyToAddress(email *requestBody) *mail.Address {
+	if email.SenderEmail == "" {
+		return nil
+	}
+	address, err := mail.ParseAddress(email.SenderEmail)
+	if err != nil {
+		return nil
+	}
+	if address.Name == "" {
+		address.Name = email.Sender
+	}
+	return address
+}
+
+// isForbiddenInHeader rejects control characters, CR and LF included,
+// along with the Unicode line and paragraph separators.
+func isForbiddenInHeader(char rune) bool {
+	return unicode.IsControl(char) || char == '\u2028' || char == '\u2029'
+}
+
+// isForbiddenInText rejects control characters, except for line breaks and tabs.
+func isForbiddenInText(char rune) bool {
+	return unicode.IsControl(char) && char != '\r' && char != '\n' && char != '\t'
+}
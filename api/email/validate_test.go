@@ -0,0 +1,179 @@
+package email
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/mail"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateEmail(t *testing.T) {
+	for _, testCase := range []struct {
+		subject        string
+		sender         string
+		expectedFields []string
+	}{
+		{subject: "Hello", sender: "Jane Doe"},
+		{subject: "Réponse à ta question ✨", sender: "Zoë"},
+		{subject: "Hello\r\nBcc: attacker@test.com", sender: "Jane", expectedFields: []string{"Subject"}},
+		{subject: "Hello", sender: "Jane\nDoe", expectedFields: []string{"Sender"}},
+		{subject: "Tab\tseparated", sender: "Null\x00byte", expectedFields: []string{"Sender", "Subject"}},
+		{subject: "Line separator", sender: "Jane", expectedFields: []string{"Subject"}},
+		{subject: "Invalid \xff UTF-8", sender: "Jane", expectedFields: []string{"Subject"}},
+		{subject: strings.Repeat("é", maxSubjectLength), sender: strings.Repeat("a", maxSenderLength)},
+		{subject: strings.Repeat("é", maxSubjectLength+1), sender: strings.Repeat("a", maxSenderLength+1), expectedFields: []string{"Sender", "Subject"}},
+	} {
+		errs := validateEmail(newTestRequestBody(testCase.subject, testCase.sender))
+		var fields []string
+		for _, err := range errs {
+			fields = append(fields, err.Field)
+		}
+		assert.Equal(t, testCase.expectedFields, fields, "Unexpected errors for subject %q and sender %q", testCase.subject, testCase.sender)
+	}
+}
+
+func TestValidateReportsEveryViolation(t *testing.T) {
+	errs := validateEmail(&requestBody{
+		Sender:             " ",
+		SenderEmail:        "Jane",
+		Subject:            "Hello\r\n",
+		Body:               "a",
+		SuccessRedirectUrl: "https://test.com/" + strings.Repeat("a", maxRedirectUrlLength),
+	})
+	assert.Equal(t, []fieldError{
+		{Field: "Sender", Code: "required", Message: "is required"},
+		{Field: "SenderEmail", Code: "invalid_email", Message: "must be a valid email address"},
+		{Field: "Subject", Code: "control_characters", Message: "must not contain control characters or line breaks"},
+		{Field: "Body", Code: "too_short", Message: "must be at least 2 characters long"},
+		{Field: "SuccessRedirectUrl", Code: "too_long", Message: "must not exceed 2048 characters"},
+	}, errs)
+}
+
+func TestValidateBody(t *testing.T) {
+	for body, expectedCode := range map[string]string{
+		"Hello,\r\n\tHow are you?":           "",
+		strings.Repeat("é", maxBodyLength):   "",
+		strings.Repeat("é", maxBodyLength+1): "too_long",
+		"Null\x00byte":                       "control_characters",
+		"Escape \x1b[31msequence":            "control_characters",
+		"Invalid \xff UTF-8":                 "invalid_utf8",
+		"\r\n\t ":                            "required",
+	} {
+		email := newTestRequestBody(emailSubject, emailSender)
+		email.Body = body
+		var codes []string
+		for _, err := range validateEmail(email) {
+			codes = append(codes, err.Code)
+		}
+		if expectedCode == "" {
+			assert.Empty(t, codes, "Rejected valid body %q", body)
+		} else {
+			assert.Equal(t, []string{expectedCode}, codes, "Unexpected errors for body %q", body)
+		}
+	}
+}
+
+func TestRejectInvalidHeaderFields(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	response := postJson(t, newTestHandler(t, mailTransport, nil), newTestRequestBody("Hello\r\nBcc: attacker@test.com", "Jane"), acceptJson)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, "application/problem+json", response.Header().Get("Content-Type"))
+	var body problemDetails
+	require.Nil(t, json.NewDecoder(response.Body).Decode(&body))
+	assert.Equal(t, "Bad Request", body.Title)
+	assert.Equal(t, []fieldError{{Field: "Subject", Code: "control_characters", Message: "must not contain control characters or line breaks"}}, body.Errors)
+	assert.Nil(t, mailTransport.lastMessage())
+}
+
+func TestValidateSenderEmail(t *testing.T) {
+	for senderEmail, expectedValid := range map[string]bool{
+		"":                                 true,
+		"jane@test.com":                    true,
+		"Jane Doe <jane@test.com>":         true,
+		`"Doe, Jane" <jane@test.com>`:      true,
+		"jane":                             false,
+		"jane@test.com, attacker@test.com": false,
+		"jane@test.com\r\nBcc: attacker@test.com":               false,
+		strings.Repeat("a", maxSenderEmailLength) + "@test.com": false,
+	} {
+		email := newTestRequestBody(emailSubject, emailSender)
+		email.SenderEmail = senderEmail
+		assert.Equal(t, expectedValid, len(validateEmail(email)) == 0, "Unexpected validation of %q", senderEmail)
+	}
+}
+
+func TestSetReplyToSenderEmail(t *testing.T) {
+	for senderEmail, expectedReplyTo := range map[string]*mail.Address{
+		"":                          nil,
+		"jane@test.com":             {Name: emailSender, Address: "jane@test.com"},
+		"Zoë Dupont <zoe@test.com>": {Name: "Zoë Dupont", Address: "zoe@test.com"},
+	} {
+		mailTransport := &fakeTransport{}
+		email := newTestRequestBody(emailSubject, emailSender)
+		email.SenderEmail = senderEmail
+		response := postJson(t, newTestHandler(t, mailTransport, nil), email, nil)
+		require.Equal(t, http.StatusFound, response.Code)
+		assert.Equal(t, expectedReplyTo, mailTransport.lastMessage().ReplyTo)
+		assert.Equal(t, sourceEmailAddress, mailTransport.lastMessage().From)
+	}
+}
+
+func TestRejectInvalidSenderEmail(t *testing.T) {
+	mailTransport := &fakeTransport{}
+	email := newTestRequestBody(emailSubject, emailSender)
+	email.SenderEmail = "not an address"
+	response := postJson(t, newTestHandler(t, mailTransport, nil), email, acceptJson)
+
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	var body problemDetails
+	require.Nil(t, json.NewDecoder(response.Body).Decode(&body))
+	assert.Equal(t, []fieldError{{Field: "SenderEmail", Code: "invalid_email", Message: "must be a valid email address"}}, body.Errors)
+	assert.Nil(t, mailTransport.lastMessage())
+}
+
+func FuzzPostEmailHeaderInjection(f *testing.F) {
+	f.Add("Hello", "Jane Doe")
+	f.Add("Hello\r\nBcc: attacker@test.com", "Jane")
+	f.Add("Hello", "Jane\r\n\r\nInjected body")
+	f.Add("Hello\nTo: attacker@test.com", "Jane\rCc: attacker@test.com")
+	f.Add("=?utf-8?q?Hello=0D=0ABcc:_attacker@test.com?=", "Jane")
+	f.Add("Héllo Bcc: attacker@test.com", "Zoë\u0085")
+	f.Add(strings.Repeat("long subject ", 30), "Jane")
+
+	f.Fuzz(func(t *testing.T, subject string, sender string) {
+		if !utf8.ValidString(subject) || !utf8.ValidString(sender) {
+			t.Skip("JSON replaces invalid UTF-8 before it reaches the handler")
+		}
+		mailTransport := &fakeTransport{}
+		response := postJson(t, newTestHandler(t, mailTransport, nil), newTestRequestBody(subject, sender), nil)
+		if response.Code == http.StatusBadRequest {
+			assert.Nil(t, mailTransport.lastMessage())
+			return
+		}
+		require.NotNil(t, mailTransport.lastMessage())
+
+		message, err := mail.ReadMessage(bytes.NewReader(mailTransport.lastMessage().Bytes()))
+		require.Nil(t, err, "Failed to parse email: %s\n", err)
+		var headerNames []string
+		for name := range message.Header {
+			headerNames = append(headerNames, name)
+		}
+		assert.ElementsMatch(t, []string{
+			"From", "To", "Subject", "Date", "Message-Id", "Mime-Version", "Content-Type",
+		}, headerNames)
+		to, err := message.Header.AddressList("To")
+		require.Nil(t, err, "Failed to parse To: %s\n", err)
+		assert.Equal(t, []*mail.Address{{Address: targetEmailAddress}}, to)
+		decodedSubject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+		require.Nil(t, err, "Failed to decode Subject: %s\n", err)
+		assert.Equal(t, strings.Join(strings.Fields(subject), " "), strings.Join(strings.Fields(decodedSubject), " "))
+	})
+}
@@ -0,0 +1,263 @@
+package blocklist
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"portfolio-back/config"
+)
+
+// Subject is what the rules are matched against.
+type Subject struct {
+	Ip     string
+	Sender string
+	// Bare address, without display name.
+	SenderEmail string
+	Subject     string
+	Body        string
+}
+
+// Match is the rule which fired, such as "block domains spam.example".
+type Match struct {
+	List string
+	Kind string
+	Rule string
+}
+
+func (match *Match) String() string {
+	return match.List + " " + match.Kind + " " + match.Rule
+}
+
+// Blocklist holds the rules of BLOCKLIST_FILE, which blocks and allows submissions.
+// The file is reloaded when it changes, checking its modification time at most every BLOCKLIST_POLL_INTERVAL,
+// so that rules apply without redeploying.
+// A nil blocklist has no rules.
+type Blocklist struct {
+	path         string
+	pollInterval time.Duration
+
+	mutex     sync.Mutex
+	lists     *lists
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+type lists struct {
+	block *ruleSet
+	allow *ruleSet
+}
+
+// New returns a blocklist without rules if BLOCKLIST_FILE is not set,
+// and fails if the file cannot be loaded, so that mistakes surface at startup.
+func New(getEnv func(string) string) (*Blocklist, error) {
+	blocklist := &Blocklist{
+		path:         getEnv("BLOCKLIST_FILE"),
+		pollInterval: config.Milliseconds(getEnv, "BLOCKLIST_POLL_INTERVAL", 5*time.Second),
+		lists:        &lists{block: &ruleSet{}, allow: &ruleSet{}},
+	}
+	if blocklist.path == "" {
+		return blocklist, nil
+	}
+	info, err := os.Stat(blocklist.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blocklist: %w", err)
+	}
+	blocklist.lists, err = loadLists(blocklist.path)
+	if err != nil {
+		return nil, err
+	}
+	blocklist.modTime = info.ModTime()
+	blocklist.checkedAt = time.Now()
+	return blocklist, nil
+}
+
+// Blocked returns the block rule matching the subject, unless an allow rule matches too.
+func (blocklist *Blocklist) Blocked(subject *Subject) *Match {
+	current := blocklist.current()
+	if current.allow.match(subject) != nil {
+		return nil
+	}
+	return current.block.match(subject)
+}
+
+// Allowed returns the allow rule matching the subject, which then bypasses spam filtering.
+func (blocklist *Blocklist) Allowed(subject *Subject) *Match {
+	return blocklist.current().allow.match(subject)
+}
+
+// AllowsIp reports whether an allow rule matches the IP, which then bypasses rate limiting.
+func (blocklist *Blocklist) AllowsIp(ip string) bool {
+	return blocklist.current().allow.matchIp(ip) != ""
+}
+
+// current returns the rules, reloaded first if the file changed.
+// Invalid files are ignored, so that a typo does not lift every rule.
+func (blocklist *Blocklist) current() *lists {
+	if blocklist == nil {
+		return &lists{block: &ruleSet{}, allow: &ruleSet{}}
+	}
+	blocklist.mutex.Lock()
+	defer blocklist.mutex.Unlock()
+	if blocklist.path == "" || time.Since(blocklist.checkedAt) < blocklist.pollInterval {
+		return blocklist.lists
+	}
+	blocklist.checkedAt = time.Now()
+
+	info, err := os.Stat(blocklist.path)
+	if err != nil {
+		log.Printf("[ERROR] Failed to check blocklist, keeping the previous rules: %s\n", err)
+		return blocklist.lists
+	}
+	if info.ModTime().Equal(blocklist.modTime) {
+		return blocklist.lists
+	}
+	reloaded, err := loadLists(blocklist.path)
+	if err != nil {
+		log.Printf("[ERROR] Failed to reload blocklist, keeping the previous rules: %s\n", err)
+	} else {
+		log.Printf("[INFO] Reloaded blocklist from %s\n", blocklist.path)
+		blocklist.lists = reloaded
+	}
+	blocklist.modTime = info.ModTime()
+	return blocklist.lists
+}
+
+// listsFile is the JSON format of BLOCKLIST_FILE.
+type listsFile struct {
+	Block *ruleSetFile `json:"block"`
+	Allow *ruleSetFile `json:"allow"`
+}
+
+type ruleSetFile struct {
+	Ips             []string `json:"ips"`
+	Senders         []string `json:"senders"`
+	SenderPatterns  []string `json:"senderPatterns"`
+	Domains         []string `json:"domains"`
+	ContentPatterns []string `json:"contentPatterns"`
+}
+
+func loadLists(path string) (*lists, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blocklist: %w", err)
+	}
+	var file listsFile
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(&file)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blocklist %s: %w", path, err)
+	}
+	block, err := newRuleSet("block", file.Block)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blocklist %s: %w", path, err)
+	}
+	allow, err := newRuleSet("allow", file.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("invalid blocklist %s: %w", path, err)
+	}
+	return &lists{block: block, allow: allow}, nil
+}
+
+type ruleSet struct {
+	name            string
+	ips             []netip.Prefix
+	senders         []string
+	senderPatterns  []*regexp.Regexp
+	domains         []string
+	contentPatterns []*regexp.Regexp
+}
+
+func newRuleSet(name string, file *ruleSetFile) (*ruleSet, error) {
+	rules := &ruleSet{name: name}
+	if file == nil {
+		return rules, nil
+	}
+	for _, rawIp := range file.Ips {
+		prefix, err := netip.ParsePrefix(rawIp)
+		if err != nil {
+			address, addressErr := netip.ParseAddr(rawIp)
+			if addressErr != nil {
+				return nil, fmt.Errorf("%s ip %q: %w", name, rawIp, err)
+			}
+			prefix = netip.PrefixFrom(address, address.BitLen())
+		}
+		rules.ips = append(rules.ips, prefix.Masked())
+	}
+	for _, sender := range file.Senders {
+		rules.senders = append(rules.senders, strings.TrimSpace(sender))
+	}
+	for _, domain := range file.Domains {
+		rules.domains = append(rules.domains, strings.ToLower(strings.Trim(strings.TrimSpace(domain), ".")))
+	}
+	var err error
+	rules.senderPatterns, err = compilePatterns(name+" senderPatterns", file.SenderPatterns)
+	if err != nil {
+		return nil, err
+	}
+	rules.contentPatterns, err = compilePatterns(name+" contentPatterns", file.ContentPatterns)
+	return rules, err
+}
+
+func compilePatterns(kind string, rawPatterns []string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, rawPattern := range rawPatterns {
+		pattern, err := regexp.Compile(rawPattern)
+		if err != nil {
+			return nil, fmt.Errorf("%s %q: %w", kind, rawPattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+func (rules *ruleSet) match(subject *Subject) *Match {
+	if rule := rules.matchIp(subject.Ip); rule != "" {
+		return &Match{List: rules.name, Kind: "ips", Rule: rule}
+	}
+	for _, sender := range rules.senders {
+		if strings.EqualFold(sender, subject.Sender) || (subject.SenderEmail != "" && strings.EqualFold(sender, subject.SenderEmail)) {
+			return &Match{List: rules.name, Kind: "senders", Rule: sender}
+		}
+	}
+	for _, pattern := range rules.senderPatterns {
+		if pattern.MatchString(subject.Sender) || (subject.SenderEmail != "" && pattern.MatchString(subject.SenderEmail)) {
+			return &Match{List: rules.name, Kind: "senderPatterns", Rule: pattern.String()}
+		}
+	}
+	if _, domain, found := strings.Cut(strings.ToLower(subject.SenderEmail), "@"); found {
+		for _, blockedDomain := range rules.domains {
+			if domain == blockedDomain || strings.HasSuffix(domain, "."+blockedDomain) {
+				return &Match{List: rules.name, Kind: "domains", Rule: blockedDomain}
+			}
+		}
+	}
+	for _, pattern := range rules.contentPatterns {
+		if pattern.MatchString(subject.Subject) || pattern.MatchString(subject.Body) {
+			return &Match{List: rules.name, Kind: "contentPatterns", Rule: pattern.String()}
+		}
+	}
+	return nil
+}
+
+func (rules *ruleSet) matchIp(ip string) string {
+	address, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+	address = address.Unmap()
+	for _, prefix := range rules.ips {
+		if prefix.Contains(address) {
+			return prefix.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,146 @@
+package blocklist
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testBlocklist = `{
+	"block": {
+		"ips": ["203.0.113.0/24", "2001:db8::1"],
+		"senders": ["Troll"],
+		"senderPatterns": ["(?i)^seo\\b"],
+		"domains": ["spam.test"],
+		"contentPatterns": ["(?i)bitcoin"]
+	},
+	"allow": {
+		"ips": ["198.51.100.7"],
+		"domains": ["friend.test"]
+	}
+}`
+
+func TestBlocked(t *testing.T) {
+	blocklist := newTestBlocklist(t, testBlocklist, nil)
+
+	for _, testCase := range []struct {
+		subject       *Subject
+		expectedMatch string
+	}{
+		{&Subject{Ip: "203.0.113.42", Sender: "Jane"}, "block ips 203.0.113.0/24"},
+		{&Subject{Ip: "::ffff:203.0.113.42", Sender: "Jane"}, "block ips 203.0.113.0/24"},
+		{&Subject{Ip: "2001:db8::1", Sender: "Jane"}, "block ips 2001:db8::1/128"},
+		{&Subject{Sender: "troll"}, "block senders Troll"},
+		{&Subject{Sender: "Jane", SenderEmail: "TROLL"}, "block senders Troll"},
+		{&Subject{Sender: "SEO expert"}, `block senderPatterns (?i)^seo\b`},
+		{&Subject{Sender: "Jane", SenderEmail: "jane@SPAM.test"}, "block domains spam.test"},
+		{&Subject{Sender: "Jane", SenderEmail: "jane@mail.spam.test"}, "block domains spam.test"},
+		{&Subject{Sender: "Jane", Subject: "Invest in Bitcoin"}, "block contentPatterns (?i)bitcoin"},
+		{&Subject{Sender: "Jane", Body: "bitcoin!"}, "block contentPatterns (?i)bitcoin"},
+		{&Subject{Ip: "203.0.114.1", Sender: "Jane", SenderEmail: "jane@notspam.test", Body: "Hello"}, ""},
+		{&Subject{Sender: "Seoul"}, ""},
+		{&Subject{Ip: "198.51.100.7", Sender: "Troll"}, ""},
+		{&Subject{Sender: "Troll", SenderEmail: "troll@friend.test"}, ""},
+	} {
+		match := blocklist.Blocked(testCase.subject)
+		if testCase.expectedMatch == "" {
+			assert.Nil(t, match, "Unexpected match for %+v", testCase.subject)
+		} else if assert.NotNil(t, match, "No match for %+v", testCase.subject) {
+			assert.Equal(t, testCase.expectedMatch, match.String())
+		}
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	blocklist := newTestBlocklist(t, testBlocklist, nil)
+
+	assert.Equal(t, "allow domains friend.test", blocklist.Allowed(&Subject{SenderEmail: "jane@friend.test"}).String())
+	assert.Nil(t, blocklist.Allowed(&Subject{SenderEmail: "jane@spam.test"}))
+	assert.True(t, blocklist.AllowsIp("198.51.100.7"))
+	assert.False(t, blocklist.AllowsIp("198.51.100.8"))
+	assert.False(t, blocklist.AllowsIp("not an ip"))
+}
+
+func TestWithoutFile(t *testing.T) {
+	blocklist, err := New(func(string) string { return "" })
+	require.Nil(t, err)
+	assert.Nil(t, blocklist.Blocked(&Subject{Ip: "203.0.113.42", Sender: "Troll"}))
+	assert.False(t, blocklist.AllowsIp("198.51.100.7"))
+
+	var noBlocklist *Blocklist
+	assert.Nil(t, noBlocklist.Blocked(&Subject{Ip: "203.0.113.42", Sender: "Troll"}))
+	assert.Nil(t, noBlocklist.Allowed(&Subject{Ip: "198.51.100.7"}))
+	assert.False(t, noBlocklist.AllowsIp("198.51.100.7"))
+}
+
+func TestRejectInvalidFiles(t *testing.T) {
+	for _, content := range []string{
+		`{`,
+		`{"block": {"unknown": []}}`,
+		`{"block": {"ips": ["300.0.0.1"]}}`,
+		`{"allow": {"senderPatterns": ["("]}}`,
+		`{"block": {"contentPatterns": ["[a-"]}}`,
+	} {
+		path := filepath.Join(t.TempDir(), "blocklist.json")
+		require.Nil(t, os.WriteFile(path, []byte(content), 0o640))
+		_, err := New(func(string) string { return path })
+		assert.NotNil(t, err, "Invalid blocklist was accepted: %s", content)
+	}
+
+	_, err := New(func(string) string { return filepath.Join(t.TempDir(), "missing.json") })
+	assert.NotNil(t, err)
+}
+
+func TestReloadOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.json")
+	require.Nil(t, os.WriteFile(path, []byte(`{"block": {"senders": ["Troll"]}}`), 0o640))
+	blocklist := newTestBlocklistFile(t, path, map[string]string{"BLOCKLIST_POLL_INTERVAL": "1"})
+	assert.NotNil(t, blocklist.Blocked(&Subject{Sender: "Troll"}))
+
+	updateBlocklist(t, path, `{"block": {"senders": ["Spammer"]}}`)
+	assert.Nil(t, blocklist.Blocked(&Subject{Sender: "Troll"}))
+	assert.NotNil(t, blocklist.Blocked(&Subject{Sender: "Spammer"}))
+
+	updateBlocklist(t, path, `{"block": {"senders": [`)
+	assert.NotNil(t, blocklist.Blocked(&Subject{Sender: "Spammer"}), "Invalid update lifted the rules")
+}
+
+func TestThrottleReloads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.json")
+	require.Nil(t, os.WriteFile(path, []byte(`{"block": {"senders": ["Troll"]}}`), 0o640))
+	blocklist := newTestBlocklistFile(t, path, map[string]string{"BLOCKLIST_POLL_INTERVAL": "3600000"})
+
+	updateBlocklist(t, path, `{}`)
+	assert.NotNil(t, blocklist.Blocked(&Subject{Sender: "Troll"}))
+}
+
+func newTestBlocklist(t *testing.T, content string, env map[string]string) *Blocklist {
+	path := filepath.Join(t.TempDir(), "blocklist.json")
+	require.Nil(t, os.WriteFile(path, []byte(content), 0o640))
+	return newTestBlocklistFile(t, path, env)
+}
+
+func newTestBlocklistFile(t *testing.T, path string, env map[string]string) *Blocklist {
+	blocklist, err := New(func(key string) string {
+		if key == "BLOCKLIST_FILE" {
+			return path
+		}
+		return env[key]
+	})
+	require.Nil(t, err)
+	return blocklist
+}
+
+// updateBlocklist rewrites the file with a later modification time, as file systems may not tell quick writes apart.
+func updateBlocklist(t *testing.T, path string, content string) {
+	info, err := os.Stat(path)
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(path, []byte(content), 0o640))
+	modTime := info.ModTime().Add(time.Second)
+	require.Nil(t, os.Chtimes(path, modTime, modTime))
+	time.Sleep(2 * time.Millisecond)
+}
@@ -0,0 +1,44 @@
+package captcha
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrRejected is wrapped by the errors of verifiers which checked the token and found it invalid,
+// as opposed to verifiers which could not check it.
+var ErrRejected = errors.New("captcha rejected")
+
+// Verifier checks the CAPTCHA tokens solved by visitors.
+type Verifier interface {
+	Verify(ctx context.Context, token string, remoteIp string) error
+}
+
+// Challenger is implemented by the verifiers which issue their own challenges,
+// which the frontend fetches before solving them.
+type Challenger interface {
+	HandleGetChallenge(response http.ResponseWriter, request *http.Request)
+}
+
+// siteverifyUrls are the endpoints of the providers with a siteverify API.
+var siteverifyUrls = map[string]string{
+	"recaptcha": "https://www.google.com/recaptcha/api/siteverify",
+	"hcaptcha":  "https://api.hcaptcha.com/siteverify",
+	"turnstile": "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// New builds the verifier selected by CAPTCHA_PROVIDER, or returns nil if CAPTCHA_PROVIDER is empty.
+func New(getEnv func(string) string) (Verifier, error) {
+	switch provider := getEnv("CAPTCHA_PROVIDER"); provider {
+	case "":
+		return nil, nil
+	case "pow":
+		return NewProofOfWork(getEnv)
+	case "siteverify", "recaptcha", "hcaptcha", "turnstile":
+		return NewSiteverify(siteverifyUrls[provider], getEnv)
+	default:
+		return nil, fmt.Errorf("unknown CAPTCHA provider %q", provider)
+	}
+}
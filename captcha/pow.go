@@ -0,0 +1,136 @@
+package captcha
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"portfolio-back/config"
+	"portfolio-back/store"
+)
+
+// ProofOfWork issues challenges signed with CAPTCHA_SECRET, which visitors solve by finding a nonce
+// such that the SHA-256 hash of "<challenge>:<nonce>" starts with CAPTCHA_POW_DIFFICULTY zero bits.
+// It needs no third party, and costs bots CPU time rather than visitors a puzzle.
+type ProofOfWork struct {
+	secret     []byte
+	difficulty int
+	maxAge     time.Duration
+	// Remembers the solved challenges until they expire, so that solutions cannot be replayed.
+	spent store.Store
+}
+
+type challengeBody struct {
+	Challenge  string `json:"challenge"`
+	Difficulty int    `json:"difficulty"`
+}
+
+func NewProofOfWork(getEnv func(string) string) (*ProofOfWork, error) {
+	secret := getEnv("CAPTCHA_SECRET")
+	if secret == "" {
+		return nil, fmt.Errorf("CAPTCHA_SECRET is required by the proof-of-work CAPTCHA provider")
+	}
+	spent, err := store.New(getEnv, "CAPTCHA")
+	if err != nil {
+		return nil, err
+	}
+	return &ProofOfWork{
+		secret:     []byte(secret),
+		difficulty: config.Int(getEnv, "CAPTCHA_POW_DIFFICULTY", 20),
+		maxAge:     config.Milliseconds(getEnv, "CAPTCHA_POW_MAX_AGE", 10*time.Minute),
+		spent:      spent,
+	}, nil
+}
+
+func (verifier *ProofOfWork) HandleGetChallenge(response http.ResponseWriter, _ *http.Request) {
+	challenge, err := verifier.issue(time.Now())
+	if err != nil {
+		http.Error(response, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	response.Header().Set("Content-Type", "application/json")
+	response.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(response).Encode(&challengeBody{Challenge: challenge, Difficulty: verifier.difficulty})
+}
+
+// issue returns a challenge made of its issue time in milliseconds and a random salt, followed by their signature.
+func (verifier *ProofOfWork) issue(now time.Time) (string, error) {
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+	payload := strconv.FormatInt(now.UnixMilli(), 10) + "." + hex.EncodeToString(salt)
+	return payload + "." + verifier.sign(payload), nil
+}
+
+func (verifier *ProofOfWork) Verify(_ context.Context, token string, _ string) error {
+	challenge, nonce, found := strings.Cut(token, ":")
+	if !found || nonce == "" {
+		return fmt.Errorf("%w: malformed token", ErrRejected)
+	}
+	payload, signature, _ := lastCut(challenge, ".")
+	if !hmac.Equal([]byte(signature), []byte(verifier.sign(payload))) {
+		return fmt.Errorf("%w: invalid signature", ErrRejected)
+	}
+	rawIssuedAt, _, _ := strings.Cut(payload, ".")
+	issuedAtMilliseconds, err := strconv.ParseInt(rawIssuedAt, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: malformed challenge", ErrRejected)
+	}
+	expiresAt := time.UnixMilli(issuedAtMilliseconds).Add(verifier.maxAge)
+	if !time.Now().Before(expiresAt) {
+		return fmt.Errorf("%w: expired challenge", ErrRejected)
+	}
+	hash := sha256.Sum256([]byte(token))
+	if leadingZeroBits(hash[:]) < verifier.difficulty {
+		return fmt.Errorf("%w: insufficient work", ErrRejected)
+	}
+
+	alreadySpent := false
+	err = verifier.spent.Update(challenge, func(entry *store.Entry) *store.Entry {
+		alreadySpent = entry != nil
+		return &store.Entry{ExpiresAt: expiresAt}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record spent challenge: %w", err)
+	}
+	if alreadySpent {
+		return fmt.Errorf("%w: challenge already solved", ErrRejected)
+	}
+	return nil
+}
+
+func (verifier *ProofOfWork) sign(payload string) string {
+	mac := hmac.New(sha256.New, verifier.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func lastCut(value string, separator string) (before string, after string, found bool) {
+	if i := strings.LastIndex(value, separator); i >= 0 {
+		return value[:i], value[i+len(separator):], true
+	}
+	return value, "", false
+}
+
+func leadingZeroBits(hash []byte) int {
+	count := 0
+	for _, b := range hash {
+		count += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	return count
+}
@@ -0,0 +1,96 @@
+package captcha
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDifficulty = 8
+
+func TestProofOfWork(t *testing.T) {
+	verifier := newTestProofOfWork(t)
+	challenge := getChallenge(t, verifier)
+
+	token := solve(challenge, testDifficulty)
+	assert.Nil(t, verifier.Verify(context.Background(), token, ""))
+
+	err := verifier.Verify(context.Background(), token, "")
+	assert.True(t, errors.Is(err, ErrRejected), "Replayed solution was accepted: %v", err)
+}
+
+func TestRejectInvalidProofsOfWork(t *testing.T) {
+	verifier := newTestProofOfWork(t)
+	challenge := getChallenge(t, verifier)
+	expiredChallenge, err := verifier.issue(time.Now().Add(-time.Hour))
+	require.Nil(t, err)
+	forgedChallenge, err := (&ProofOfWork{secret: []byte("other")}).issue(time.Now())
+	require.Nil(t, err)
+
+	for name, token := range map[string]string{
+		"missing":      "",
+		"no nonce":     challenge + ":",
+		"unsolved":     unsolve(challenge, testDifficulty),
+		"expired":      solve(expiredChallenge, testDifficulty),
+		"forged":       solve(forgedChallenge, testDifficulty),
+		"tampered":     solve("1"+challenge, testDifficulty),
+		"unsigned":     solve("garbage", testDifficulty),
+		"bad issuance": solve("abc."+verifier.sign("abc"), testDifficulty),
+	} {
+		err := verifier.Verify(context.Background(), token, "")
+		assert.True(t, errors.Is(err, ErrRejected), "Unexpected error for %s token: %v", name, err)
+	}
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	assert.Equal(t, 0, leadingZeroBits([]byte{0x80, 0x00}))
+	assert.Equal(t, 3, leadingZeroBits([]byte{0x10, 0x00}))
+	assert.Equal(t, 12, leadingZeroBits([]byte{0x00, 0x08}))
+	assert.Equal(t, 16, leadingZeroBits([]byte{0x00, 0x00}))
+}
+
+func newTestProofOfWork(t *testing.T) *ProofOfWork {
+	verifier, err := NewProofOfWork(func(key string) string {
+		return map[string]string{"CAPTCHA_SECRET": "secret", "CAPTCHA_POW_DIFFICULTY": strconv.Itoa(testDifficulty)}[key]
+	})
+	require.Nil(t, err)
+	return verifier
+}
+
+func getChallenge(t *testing.T, verifier *ProofOfWork) string {
+	response := httptest.NewRecorder()
+	verifier.HandleGetChallenge(response, httptest.NewRequest(http.MethodGet, "/api/email/captcha", nil))
+	require.Equal(t, http.StatusOK, response.Code)
+	var body challengeBody
+	require.Nil(t, json.NewDecoder(response.Body).Decode(&body))
+	assert.Equal(t, testDifficulty, body.Difficulty)
+	return body.Challenge
+}
+
+// solve finds a nonce as the frontend would.
+func solve(challenge string, difficulty int) string {
+	return findNonce(challenge, func(zeroBits int) bool { return zeroBits >= difficulty })
+}
+
+func unsolve(challenge string, difficulty int) string {
+	return findNonce(challenge, func(zeroBits int) bool { return zeroBits < difficulty })
+}
+
+func findNonce(challenge string, isWanted func(zeroBits int) bool) string {
+	for nonce := 0; ; nonce++ {
+		token := challenge + ":" + strconv.Itoa(nonce)
+		hash := sha256.Sum256([]byte(token))
+		if isWanted(leadingZeroBits(hash[:])) {
+			return token
+		}
+	}
+}
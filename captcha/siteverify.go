@@ -0,0 +1,74 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"portfolio-back/config"
+)
+
+// Siteverify checks tokens against a siteverify API, as offered by reCAPTCHA, hCaptcha and Turnstile.
+type Siteverify struct {
+	url        string
+	secret     string
+	httpClient *http.Client
+}
+
+type siteverifyResponse struct {
+	Success    bool     `json:"success"`
+	ErrorCodes []string `json:"error-codes"`
+}
+
+// NewSiteverify posts tokens to CAPTCHA_VERIFY_URL, which defaults to defaultUrl.
+func NewSiteverify(defaultUrl string, getEnv func(string) string) (*Siteverify, error) {
+	verifier := &Siteverify{
+		url:        config.String(getEnv, "CAPTCHA_VERIFY_URL", defaultUrl),
+		secret:     getEnv("CAPTCHA_SECRET"),
+		httpClient: &http.Client{},
+	}
+	if verifier.url == "" {
+		return nil, fmt.Errorf("CAPTCHA_VERIFY_URL is required by the siteverify CAPTCHA provider")
+	}
+	if verifier.secret == "" {
+		return nil, fmt.Errorf("CAPTCHA_SECRET is required by the siteverify CAPTCHA provider")
+	}
+	return verifier, nil
+}
+
+func (verifier *Siteverify) Verify(ctx context.Context, token string, remoteIp string) error {
+	if token == "" {
+		return fmt.Errorf("%w: missing token", ErrRejected)
+	}
+	form := url.Values{"secret": {verifier.secret}, "response": {token}}
+	if remoteIp != "" {
+		form.Set("remoteip", remoteIp)
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, verifier.url, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	response, err := verifier.httpClient.Do(request)
+	if err != nil {
+		return fmt.Errorf("failed to reach CAPTCHA provider: %w", err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("CAPTCHA provider responded with status %d", response.StatusCode)
+	}
+	var result siteverifyResponse
+	err = json.NewDecoder(io.LimitReader(response.Body, 1<<20)).Decode(&result)
+	if err != nil {
+		return fmt.Errorf("invalid response from CAPTCHA provider: %w", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("%w: %s", ErrRejected, strings.Join(result.ErrorCodes, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package captcha
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSiteverify(t *testing.T) {
+	var received url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		require.Nil(t, request.ParseForm())
+		received = request.PostForm
+		result := siteverifyResponse{Success: request.PostForm.Get("response") == "solved"}
+		if !result.Success {
+			result.ErrorCodes = []string{"invalid-input-response"}
+		}
+		json.NewEncoder(response).Encode(&result)
+	}))
+	defer server.Close()
+	verifier := newTestSiteverify(t, server.URL)
+
+	err := verifier.Verify(context.Background(), "solved", "198.51.100.1")
+	assert.Nil(t, err)
+	assert.Equal(t, url.Values{"secret": {"secret"}, "response": {"solved"}, "remoteip": {"198.51.100.1"}}, received)
+
+	err = verifier.Verify(context.Background(), "unsolved", "198.51.100.1")
+	assert.True(t, errors.Is(err, ErrRejected), "Unexpected error: %v", err)
+	assert.ErrorContains(t, err, "invalid-input-response")
+
+	err = verifier.Verify(context.Background(), "", "198.51.100.1")
+	assert.True(t, errors.Is(err, ErrRejected), "Unexpected error: %v", err)
+}
+
+func TestSiteverifyUnavailable(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+		response.WriteHeader(http.StatusInternalServerError)
+	}))
+	verifier := newTestSiteverify(t, server.URL)
+
+	err := verifier.Verify(context.Background(), "solved", "")
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, ErrRejected), "Unavailable provider rejected the token")
+
+	server.Close()
+	err = verifier.Verify(context.Background(), "solved", "")
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, ErrRejected), "Unreachable provider rejected the token")
+}
+
+func TestNew(t *testing.T) {
+	env := map[string]string{}
+	getEnv := func(key string) string { return env[key] }
+
+	verifier, err := New(getEnv)
+	require.Nil(t, err)
+	assert.Nil(t, verifier)
+
+	env["CAPTCHA_PROVIDER"] = "turnstile"
+	_, err = New(getEnv)
+	assert.NotNil(t, err, "Missing secret was accepted")
+
+	env["CAPTCHA_SECRET"] = "secret"
+	verifier, err = New(getEnv)
+	require.Nil(t, err)
+	assert.Equal(t, siteverifyUrls["turnstile"], verifier.(*Siteverify).url)
+
+	env["CAPTCHA_PROVIDER"] = "siteverify"
+	_, err = New(getEnv)
+	assert.NotNil(t, err, "Missing URL was accepted")
+
+	env["CAPTCHA_PROVIDER"] = "pow"
+	verifier, err = New(getEnv)
+	require.Nil(t, err)
+	assert.Implements(t, (*Challenger)(nil), verifier)
+
+	env["CAPTCHA_PROVIDER"] = "riddle"
+	_, err = New(getEnv)
+	assert.NotNil(t, err)
+}
+
+func newTestSiteverify(t *testing.T, url string) *Siteverify {
+	verifier, err := NewSiteverify("", func(key string) string {
+		return map[string]string{"CAPTCHA_VERIFY_URL": url, "CAPTCHA_SECRET": "secret"}[key]
+	})
+	require.Nil(t, err)
+	return verifier
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func Int(getEnv func(string) string, key string, fallback int) int {
+	rawValue := getEnv(key)
+	if rawValue == "" {
+		return fallback
+	}
+	value, err := strconv.Atoi(rawValue)
+	if err != nil {
+		log.Printf("[ERROR] Invalid %s, defaulting to %d: %s\n", key, fallback, err)
+		return fallback
+	}
+	return value
+}
+
+func Float(getEnv func(string) string, key string, fallback float64) float64 {
+	rawValue := getEnv(key)
+	if rawValue == "" {
+		return fallback
+	}
+	value, err := strconv.ParseFloat(rawValue, 64)
+	if err != nil {
+		log.Printf("[ERROR] Invalid %s, defaulting to %g: %s\n", key, fallback, err)
+		return fallback
+	}
+	return value
+}
+
+// Milliseconds reads a duration expressed as an integer number of milliseconds,
+// like TIMEOUT_REQUEST_PROCESSING.
+func Milliseconds(getEnv func(string) string, key string, fallback time.Duration) time.Duration {
+	return time.Duration(Int(getEnv, key, int(fallback.Milliseconds()))) * time.Millisecond
+}
+
+func String(getEnv func(string) string, key string, fallback string) string {
+	value := getEnv(key)
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// List reads a comma-separated list, ignoring blank items.
+func List(getEnv func(string) string, key string) []string {
+	var values []string
+	for _, value := range strings.Split(getEnv(key), ",") {
+		value = strings.TrimSpace(value)
+		if value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+// Override returns a getEnv which reports value for key, if value is set,
+// and delegates to the wrapped getEnv otherwise.
+func Override(getEnv func(string) string, key string, value string) func(string) string {
+	return func(requestedKey string) string {
+		if requestedKey == key && value != "" {
+			return value
+		}
+		return getEnv(requestedKey)
+	}
+}
+
+// Prefixed returns a getEnv which looks up keys under prefix first, such as PRIMARY_SMTP_SERVER_PORT,
+// then falls back to the unprefixed key.
+func Prefixed(getEnv func(string) string, prefix string) func(string) string {
+	return func(key string) string {
+		if value := getEnv(prefix + "_" + key); value != "" {
+			return value
+		}
+		return getEnv(key)
+	}
+}
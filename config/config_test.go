@@ -0,0 +1,60 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func mockGetEnv(values map[string]string) func(string) string {
+	return func(key string) string {
+		return values[key]
+	}
+}
+
+func TestInt(t *testing.T) {
+	getEnv := mockGetEnv(map[string]string{"VALID": "42", "INVALID": "forty-two"})
+	assert.Equal(t, 42, Int(getEnv, "VALID", 1))
+	assert.Equal(t, 1, Int(getEnv, "INVALID", 1))
+	assert.Equal(t, 1, Int(getEnv, "MISSING", 1))
+}
+
+func TestFloat(t *testing.T) {
+	getEnv := mockGetEnv(map[string]string{"VALID": "2.5", "INVALID": "two"})
+	assert.Equal(t, 2.5, Float(getEnv, "VALID", 1))
+	assert.Equal(t, 1.0, Float(getEnv, "INVALID", 1))
+	assert.Equal(t, 1.0, Float(getEnv, "MISSING", 1))
+}
+
+func TestMilliseconds(t *testing.T) {
+	getEnv := mockGetEnv(map[string]string{"TIMEOUT": "1500"})
+	assert.Equal(t, 1500*time.Millisecond, Milliseconds(getEnv, "TIMEOUT", time.Second))
+	assert.Equal(t, time.Second, Milliseconds(getEnv, "MISSING", time.Second))
+}
+
+func TestString(t *testing.T) {
+	getEnv := mockGetEnv(map[string]string{"ADDRESS": ":3000"})
+	assert.Equal(t, ":3000", String(getEnv, "ADDRESS", ":8080"))
+	assert.Equal(t, ":8080", String(getEnv, "MISSING", ":8080"))
+}
+
+func TestList(t *testing.T) {
+	getEnv := mockGetEnv(map[string]string{"ITEMS": " first,, second ,"})
+	assert.Equal(t, []string{"first", "second"}, List(getEnv, "ITEMS"))
+	assert.Empty(t, List(getEnv, "MISSING"))
+}
+
+func TestOverride(t *testing.T) {
+	getEnv := mockGetEnv(map[string]string{"MODE": "lambda", "OTHER": "value"})
+	assert.Equal(t, "http", Override(getEnv, "MODE", "http")("MODE"))
+	assert.Equal(t, "value", Override(getEnv, "MODE", "http")("OTHER"))
+	assert.Equal(t, "lambda", Override(getEnv, "MODE", "")("MODE"))
+}
+
+func TestPrefixed(t *testing.T) {
+	getEnv := mockGetEnv(map[string]string{"BACKUP_PORT": "465", "PORT": "587", "HOST": "localhost"})
+	assert.Equal(t, "465", Prefixed(getEnv, "BACKUP")("PORT"))
+	assert.Equal(t, "localhost", Prefixed(getEnv, "BACKUP")("HOST"))
+	assert.Equal(t, "587", Prefixed(getEnv, "PRIMARY")("PORT"))
+}
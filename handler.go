@@ -12,10 +12,14 @@ func NewHandler(
 	appContext context.Context,
 	shutdownWaitGroup *sync.WaitGroup,
 	getEnv func(string) string,
-) http.Handler {
+) (http.Handler, error) {
 	serveMux := http.NewServeMux()
-	InstallRoutes(serveMux, appContext, shutdownWaitGroup, getEnv)
+	err := InstallRoutes(serveMux, appContext, shutdownWaitGroup, getEnv)
+	if err != nil {
+		return nil, err
+	}
 	var handler http.Handler = middleware.Context(serveMux, appContext)
 	handler = middleware.Timeout(handler, getEnv)
-	return handler
+	handler = middleware.ClientIp(handler, getEnv)
+	return handler, nil
 }
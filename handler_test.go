@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRequestTimeout = 200 * time.Millisecond
+
+func TestHandlerCutsOffSlowSmtpServer(t *testing.T) {
+	smtpListener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		log.Panicf("Failed to start TCP listener for SMTP server: %s\n", err)
+	}
+	defer smtpListener.Close()
+	go acceptSilently(smtpListener)
+
+	appContext, triggerShutdown := context.WithCancel(context.Background())
+	defer triggerShutdown()
+	smtpServerPort := smtpListener.Addr().(*net.TCPAddr).Port
+	handler, err := NewHandler(appContext, &sync.WaitGroup{}, mockGetEnvWithSlowSmtpServer(smtpServerPort))
+	require.Nil(t, err, "Failed to create handler: %s\n", err)
+
+	request := httptest.NewRequest(http.MethodPost, "/api/email", strings.NewReader(`{"Sender":"Test sender","Subject":"Test subject","Body":"Test body"}`))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+	recorder := httptest.NewRecorder()
+	start := time.Now()
+	handler.ServeHTTP(recorder, request)
+
+	assert.Less(t, time.Since(start), 10*testRequestTimeout)
+	assert.GreaterOrEqual(t, recorder.Code, http.StatusInternalServerError)
+}
+
+// acceptSilently accepts connections and never answers,
+// as an SMTP server that hangs before its greeting.
+func acceptSilently(listener net.Listener) {
+	var conns []net.Conn
+	defer func() {
+		for _, conn := range conns {
+			conn.Close()
+		}
+	}()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conns = append(conns, conn)
+	}
+}
+
+func mockGetEnvWithSlowSmtpServer(smtpServerPort int) func(string) string {
+	return func(key string) string {
+		switch key {
+		case "SMTP_CLIENT_DOMAIN", "SMTP_SERVER_DOMAIN":
+			return "localhost"
+		case "SMTP_SERVER_PORT":
+			return strconv.Itoa(smtpServerPort)
+		case "SMTP_COMMAND_TIMEOUT":
+			return "60000"
+		case "SMTP_DIAL_ATTEMPTS":
+			return "1"
+		case "TARGET_EMAIL_ADDRESS":
+			return "target@test.com"
+		case "SOURCE_EMAIL_ADDRESS":
+			return "source@test.com"
+		case "SOURCE_EMAIL_PASSWORD":
+			return "password"
+		case "EMAIL_TEMPLATES_DIRECTORY":
+			return "api/email/templates"
+		case "TIMEOUT_REQUEST_PROCESSING":
+			return strconv.Itoa(int(testRequestTimeout.Milliseconds()))
+		default:
+			return ""
+		}
+	}
+}
@@ -2,23 +2,38 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/awslabs/aws-lambda-go-api-proxy/httpadapter"
+
+	"portfolio-back/config"
 )
 
 func run(appContext context.Context, getEnv func(string) string) {
 	shutdownWaitGroup := &sync.WaitGroup{}
-	handler := NewHandler(appContext, shutdownWaitGroup, getEnv)
-	go serve(appContext, handler)
+	handler, err := NewHandler(appContext, shutdownWaitGroup, getEnv)
+	if err != nil {
+		log.Fatalf("[FATAL] Invalid configuration: %s\n", err)
+	}
+	switch runtimeMode := config.String(getEnv, "RUNTIME_MODE", "lambda"); runtimeMode {
+	case "lambda":
+		go serveLambda(appContext, handler)
+	case "http":
+		serveHttp(appContext, shutdownWaitGroup, handler, getEnv)
+	default:
+		log.Fatalf("[FATAL] Unknown runtime mode %q\n", runtimeMode)
+	}
 	shutdownWaitGroup.Wait()
 }
 
-func serve(appContext context.Context, handler http.Handler) {
+func serveLambda(appContext context.Context, handler http.Handler) {
 	log.Println("[INFO] HTTP server listening")
 	lambda.StartWithOptions(
 		httpadapter.NewV2(handler).ProxyWithContext,
@@ -30,5 +45,9 @@ func serve(appContext context.Context, handler http.Handler) {
 }
 
 func main() {
-	run(context.Background(), os.Getenv)
+	runtimeMode := flag.String("runtime", "", "Runtime mode, overriding RUNTIME_MODE: lambda or http")
+	flag.Parse()
+	appContext, stopListeningForSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopListeningForSignals()
+	run(appContext, config.Override(os.Getenv, "RUNTIME_MODE", *runtimeMode))
 }
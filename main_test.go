@@ -20,6 +20,7 @@ import (
 const lambdaServerUrl = "http://localhost:3000"
 
 const targetEmailAddress = "target@test.com"
+const emailSender = "Test sender"
 const emailSubject = "Test subject"
 const emailBody = "Test body"
 
@@ -100,6 +101,7 @@ type requestBody struct {
 
 func newPostBody() io.Reader {
 	requestBody := &requestBody{
+		Sender:  emailSender,
 		Subject: emailSubject,
 		Body:    emailBody,
 	}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/awslabs/aws-lambda-go-api-proxy/core"
+
+	"portfolio-back/config"
+)
+
+// ClientIp replaces the remote address of requests with the IP address of the client.
+// Behind API Gateway, it is the source IP of the request context.
+// Standalone, it is the rightmost X-Forwarded-For entry which is not one of the TRUSTED_PROXIES,
+// if the request comes from one of them, so that clients cannot spoof their address.
+func ClientIp(handler http.Handler, getEnv func(string) string) http.Handler {
+	trustedProxies := loadTrustedProxies(getEnv)
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if gatewayContext, ok := core.GetAPIGatewayV2ContextFromContext(request.Context()); ok {
+			request.RemoteAddr = gatewayContext.HTTP.SourceIP
+		} else {
+			request.RemoteAddr = forwardedClientIp(request, trustedProxies)
+		}
+		handler.ServeHTTP(response, request)
+	})
+}
+
+func loadTrustedProxies(getEnv func(string) string) []netip.Prefix {
+	var trustedProxies []netip.Prefix
+	for _, rawProxy := range config.List(getEnv, "TRUSTED_PROXIES") {
+		proxy, err := netip.ParsePrefix(rawProxy)
+		if err != nil {
+			address, addressErr := netip.ParseAddr(rawProxy)
+			if addressErr != nil {
+				log.Printf("[ERROR] Ignoring invalid trusted proxy %q: %s\n", rawProxy, err)
+				continue
+			}
+			proxy = netip.PrefixFrom(address, address.BitLen())
+		}
+		trustedProxies = append(trustedProxies, proxy.Masked())
+	}
+	return trustedProxies
+}
+
+func forwardedClientIp(request *http.Request, trustedProxies []netip.Prefix) string {
+	clientIp := remoteIp(request)
+	if !isTrustedProxy(clientIp, trustedProxies) {
+		return clientIp
+	}
+	forwardedFor := strings.Split(strings.Join(request.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwardedFor) - 1; i >= 0; i-- {
+		forwardedIp := strings.TrimSpace(forwardedFor[i])
+		if _, err := netip.ParseAddr(forwardedIp); err != nil {
+			// Entries left of an invalid one cannot be trusted either.
+			break
+		}
+		clientIp = forwardedIp
+		if !isTrustedProxy(clientIp, trustedProxies) {
+			break
+		}
+	}
+	return clientIp
+}
+
+func isTrustedProxy(ip string, trustedProxies []netip.Prefix) bool {
+	address, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	address = address.Unmap()
+	for _, proxy := range trustedProxies {
+		if proxy.Contains(address) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIp returns the remote address of the request without its port, if any.
+func remoteIp(request *http.Request) string {
+	host, _, err := net.SplitHostPort(request.RemoteAddr)
+	if err != nil {
+		return request.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/awslabs/aws-lambda-go-api-proxy/core"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIpFromForwardedFor(t *testing.T) {
+	getEnv := func(key string) string {
+		if key == "TRUSTED_PROXIES" {
+			return "10.0.0.0/8, 192.168.1.1, invalid"
+		}
+		return ""
+	}
+	testCases := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		expectedIp   string
+	}{
+		{"untrusted peer", "203.0.113.7:1234", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted peer without header", "10.1.2.3:1234", nil, "10.1.2.3"},
+		{"single proxy", "10.1.2.3:1234", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed leftmost entry", "10.1.2.3:1234", []string{"1.1.1.1, 198.51.100.1"}, "198.51.100.1"},
+		{"chained proxies", "10.1.2.3:1234", []string{"198.51.100.1, 192.168.1.1", "10.9.9.9"}, "198.51.100.1"},
+		{"only proxies", "10.1.2.3:1234", []string{"10.4.4.4, 192.168.1.1"}, "10.4.4.4"},
+		{"invalid entry", "10.1.2.3:1234", []string{"198.51.100.1, garbage, 10.4.4.4"}, "10.4.4.4"},
+		{"ipv6 peer", "[2001:db8::1]:1234", []string{"198.51.100.1"}, "2001:db8::1"},
+	}
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = testCase.remoteAddr
+			for _, value := range testCase.forwardedFor {
+				request.Header.Add("X-Forwarded-For", value)
+			}
+			assert.Equal(t, testCase.expectedIp, serveClientIp(request, getEnv))
+		})
+	}
+}
+
+func TestClientIpFromApiGateway(t *testing.T) {
+	event := events.APIGatewayV2HTTPRequest{
+		RawPath: "/",
+		Headers: map[string]string{"X-Forwarded-For": "1.1.1.1"},
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{Method: http.MethodGet, SourceIP: "198.51.100.1"},
+		},
+	}
+	request, err := (&core.RequestAccessorV2{}).EventToRequestWithContext(context.Background(), event)
+	require.Nil(t, err)
+	request.RemoteAddr = "10.1.2.3"
+
+	getEnv := func(string) string { return "10.0.0.0/8" }
+	assert.Equal(t, "198.51.100.1", serveClientIp(request, getEnv))
+}
+
+func serveClientIp(request *http.Request, getEnv func(string) string) string {
+	var clientIp string
+	handler := ClientIp(http.HandlerFunc(func(_ http.ResponseWriter, request *http.Request) {
+		clientIp = request.RemoteAddr
+	}), getEnv)
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+	return clientIp
+}
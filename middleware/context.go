@@ -5,9 +5,15 @@ import (
 	"net/http"
 )
 
+// Context cancels the request context when the app shuts down,
+// while keeping the deadline and cancellation of the request itself.
 func Context(handler http.Handler, appContext context.Context) http.Handler {
 	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
-		request = request.WithContext(appContext)
+		requestContext, cancelRequest := context.WithCancel(request.Context())
+		defer cancelRequest()
+		stopCancellingOnShutdown := context.AfterFunc(appContext, cancelRequest)
+		defer stopCancellingOnShutdown()
+		request = request.WithContext(requestContext)
 		handler.ServeHTTP(response, request)
 	})
 }
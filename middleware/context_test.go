@@ -60,6 +60,21 @@ func TestAppNotCancelled(t *testing.T) {
 	assert.Equal(t, 0, responseCancelled)
 }
 
+func TestRequestDeadlineKept(t *testing.T) {
+	requestDeadline := time.Now().Add(time.Minute)
+	var handlerDeadline time.Time
+	handler := func(response http.ResponseWriter, request *http.Request) {
+		handlerDeadline, _ = request.Context().Deadline()
+	}
+
+	requestContext, freeContext := context.WithDeadline(context.Background(), requestDeadline)
+	defer freeContext()
+	request := httptest.NewRequest(http.MethodGet, "/", nil).WithContext(requestContext)
+	Context(http.HandlerFunc(handler), context.Background()).ServeHTTP(httptest.NewRecorder(), request)
+
+	assert.Equal(t, requestDeadline, handlerDeadline)
+}
+
 func setupHttpServerWithContext(handler http.HandlerFunc, appContext context.Context) *httptest.Server {
 	handlerWithTimeout := Context(handler, appContext)
 	return httptest.NewServer(handlerWithTimeout)
@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"portfolio-back/config"
+	"portfolio-back/store"
+)
+
+// tokenBucket allows bursts of up to burst requests, then one request per interval.
+type tokenBucket struct {
+	burst    int
+	interval time.Duration
+}
+
+type bucketState struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// RateLimit rejects requests with a 429 status once the client or all clients together exhaust their token bucket.
+// Buckets are kept in limitStore, and requests are let through if it fails.
+// Requests for which isExempt returns true are neither limited nor counted.
+func RateLimit(
+	handler http.Handler,
+	limitStore store.Store,
+	isExempt func(request *http.Request) bool,
+	getEnv func(string) string,
+) http.Handler {
+	perIpLimit := &tokenBucket{
+		burst:    config.Int(getEnv, "RATE_LIMIT_PER_IP_BURST", 5),
+		interval: config.Milliseconds(getEnv, "RATE_LIMIT_PER_IP_INTERVAL", time.Minute),
+	}
+	globalLimit := &tokenBucket{
+		burst:    config.Int(getEnv, "RATE_LIMIT_GLOBAL_BURST", 100),
+		interval: config.Milliseconds(getEnv, "RATE_LIMIT_GLOBAL_INTERVAL", time.Second),
+	}
+
+	return http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		if isExempt != nil && isExempt(request) {
+			handler.ServeHTTP(response, request)
+			return
+		}
+		clientIp := remoteIp(request)
+		// The client bucket is checked first, so that a single client cannot drain the global one.
+		retryAfter := perIpLimit.take(limitStore, "ip:"+clientIp)
+		if retryAfter == 0 {
+			retryAfter = globalLimit.take(limitStore, "global")
+		}
+		if retryAfter > 0 {
+			log.Printf("[WARN] Rate limited %s %s from %s\n", request.Method, request.URL.Path, clientIp)
+			writeTooManyRequests(response, retryAfter)
+			return
+		}
+		handler.ServeHTTP(response, request)
+	})
+}
+
+// take consumes a token from the bucket of key,
+// and returns how long to wait for the next one if none is left.
+func (bucket *tokenBucket) take(limitStore store.Store, key string) time.Duration {
+	if bucket.burst <= 0 || bucket.interval <= 0 {
+		return 0
+	}
+	var retryAfter time.Duration
+	err := limitStore.Update(key, func(entry *store.Entry) *store.Entry {
+		state := &bucketState{Tokens: float64(bucket.burst)}
+		if entry != nil {
+			err := json.Unmarshal(entry.Value, state)
+			if err != nil {
+				log.Printf("[ERROR] Resetting unreadable rate limit of %s: %s\n", key, err)
+				state = &bucketState{Tokens: float64(bucket.burst)}
+			}
+		}
+		now := time.Now()
+		retryAfter = bucket.consume(state, now)
+		value, err := json.Marshal(state)
+		if err != nil {
+			return entry
+		}
+		// Once refilled, the bucket is identical to a missing one.
+		refilledAt := now.Add(time.Duration((float64(bucket.burst) - state.Tokens) * float64(bucket.interval)))
+		return &store.Entry{Value: value, ExpiresAt: refilledAt}
+	})
+	if err != nil {
+		log.Printf("[ERROR] Failed to apply rate limit of %s, letting the request through: %s\n", key, err)
+		return 0
+	}
+	return retryAfter
+}
+
+// consume refills the bucket with the tokens earned since its last update, then takes one if available.
+func (bucket *tokenBucket) consume(state *bucketState, now time.Time) time.Duration {
+	if !state.UpdatedAt.IsZero() && now.After(state.UpdatedAt) {
+		earned := float64(now.Sub(state.UpdatedAt)) / float64(bucket.interval)
+		state.Tokens = math.Min(float64(bucket.burst), state.Tokens+earned)
+	}
+	state.UpdatedAt = now
+	if state.Tokens >= 1 {
+		state.Tokens--
+		return 0
+	}
+	return time.Duration((1 - state.Tokens) * float64(bucket.interval))
+}
+
+func writeTooManyRequests(response http.ResponseWriter, retryAfter time.Duration) {
+	retryAfterSeconds := int(math.Ceil(retryAfter.Seconds()))
+	response.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+	response.Header().Set("Content-Type", "application/problem+json")
+	response.WriteHeader(http.StatusTooManyRequests)
+	fmt.Fprintf(
+		response,
+		`{"type":"about:blank","title":%q,"status":%d,"detail":"Retry in %d seconds"}`,
+		http.StatusText(http.StatusTooManyRequests),
+		http.StatusTooManyRequests,
+		retryAfterSeconds,
+	)
+}
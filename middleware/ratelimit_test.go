@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"portfolio-back/store"
+)
+
+type failingStore struct{}
+
+func (failingStore) Update(string, func(*store.Entry) *store.Entry) error {
+	return errors.New("store unavailable")
+}
+
+func TestRateLimitPerIp(t *testing.T) {
+	handler := newRateLimitedHandler(store.NewMemory(), map[string]string{
+		"RATE_LIMIT_PER_IP_BURST":    "2",
+		"RATE_LIMIT_PER_IP_INTERVAL": "60000",
+	})
+
+	assert.Equal(t, http.StatusOK, serveFrom(handler, "198.51.100.1").Code)
+	assert.Equal(t, http.StatusOK, serveFrom(handler, "198.51.100.1").Code)
+	response := serveFrom(handler, "198.51.100.1")
+	assert.Equal(t, http.StatusTooManyRequests, response.Code)
+	assert.Equal(t, "60", response.Header().Get("Retry-After"))
+	assert.Equal(t, "application/problem+json", response.Header().Get("Content-Type"))
+	assert.JSONEq(
+		t,
+		`{"type":"about:blank","title":"Too Many Requests","status":429,"detail":"Retry in 60 seconds"}`,
+		response.Body.String(),
+	)
+
+	assert.Equal(t, http.StatusOK, serveFrom(handler, "198.51.100.2").Code)
+}
+
+func TestRateLimitGlobally(t *testing.T) {
+	handler := newRateLimitedHandler(store.NewMemory(), map[string]string{
+		"RATE_LIMIT_GLOBAL_BURST":    "2",
+		"RATE_LIMIT_GLOBAL_INTERVAL": "1500",
+	})
+
+	assert.Equal(t, http.StatusOK, serveFrom(handler, "198.51.100.1").Code)
+	assert.Equal(t, http.StatusOK, serveFrom(handler, "198.51.100.2").Code)
+	response := serveFrom(handler, "198.51.100.3")
+	assert.Equal(t, http.StatusTooManyRequests, response.Code)
+	assert.Equal(t, "2", response.Header().Get("Retry-After"))
+}
+
+func TestRateLimitIsSharedThroughStore(t *testing.T) {
+	limitStore, err := store.NewFile(t.TempDir())
+	assert.Nil(t, err)
+	env := map[string]string{"RATE_LIMIT_PER_IP_BURST": "1"}
+
+	assert.Equal(t, http.StatusOK, serveFrom(newRateLimitedHandler(limitStore, env), "198.51.100.1").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serveFrom(newRateLimitedHandler(limitStore, env), "198.51.100.1").Code)
+}
+
+func TestRateLimitFailsOpen(t *testing.T) {
+	handler := newRateLimitedHandler(failingStore{}, map[string]string{"RATE_LIMIT_PER_IP_BURST": "1"})
+
+	assert.Equal(t, http.StatusOK, serveFrom(handler, "198.51.100.1").Code)
+	assert.Equal(t, http.StatusOK, serveFrom(handler, "198.51.100.1").Code)
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	handler := newRateLimitedHandler(store.NewMemory(), map[string]string{
+		"RATE_LIMIT_PER_IP_BURST": "0",
+		"RATE_LIMIT_GLOBAL_BURST": "0",
+	})
+
+	for range 10 {
+		assert.Equal(t, http.StatusOK, serveFrom(handler, "198.51.100.1").Code)
+	}
+}
+
+func TestRateLimitExemptions(t *testing.T) {
+	handler := RateLimit(
+		http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+		store.NewMemory(),
+		func(request *http.Request) bool { return request.RemoteAddr == "198.51.100.1" },
+		func(key string) string {
+			return map[string]string{"RATE_LIMIT_PER_IP_BURST": "1", "RATE_LIMIT_GLOBAL_BURST": "1"}[key]
+		},
+	)
+
+	for range 3 {
+		assert.Equal(t, http.StatusOK, serveFrom(handler, "198.51.100.1").Code)
+	}
+	assert.Equal(t, http.StatusOK, serveFrom(handler, "198.51.100.2").Code)
+	assert.Equal(t, http.StatusTooManyRequests, serveFrom(handler, "198.51.100.2").Code)
+}
+
+func TestTokenBucketRefills(t *testing.T) {
+	bucket := &tokenBucket{burst: 2, interval: time.Second}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	state := &bucketState{Tokens: 2}
+
+	assert.Zero(t, bucket.consume(state, now))
+	assert.Zero(t, bucket.consume(state, now))
+	assert.Equal(t, time.Second, bucket.consume(state, now))
+	assert.Equal(t, 500*time.Millisecond, bucket.consume(state, now.Add(500*time.Millisecond)))
+	assert.Zero(t, bucket.consume(state, now.Add(time.Second)))
+	assert.Zero(t, bucket.consume(state, now.Add(time.Hour)))
+	assert.Equal(t, 1.0, state.Tokens)
+}
+
+func newRateLimitedHandler(limitStore store.Store, env map[string]string) http.Handler {
+	handler := http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})
+	return RateLimit(handler, limitStore, nil, func(key string) string { return env[key] })
+}
+
+func serveFrom(handler http.Handler, clientIp string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/api/email", nil)
+	request.RemoteAddr = clientIp
+	response := httptest.NewRecorder()
+	handler.ServeHTTP(response, request)
+	return response
+}
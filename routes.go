@@ -6,6 +6,11 @@ import (
 	"sync"
 
 	"portfolio-back/api/email"
+	"portfolio-back/blocklist"
+	"portfolio-back/captcha"
+	"portfolio-back/middleware"
+	"portfolio-back/store"
+	"portfolio-back/transport"
 )
 
 func InstallRoutes(
@@ -13,6 +18,34 @@ func InstallRoutes(
 	appContext context.Context,
 	shutdownWaitGroup *sync.WaitGroup,
 	getEnv func(string) string,
-) {
-	serveMux.HandleFunc("POST /api/email", email.HandlePostEmail(appContext, shutdownWaitGroup, getEnv))
+) error {
+	mailTransport, err := transport.New(appContext, shutdownWaitGroup, getEnv)
+	if err != nil {
+		return err
+	}
+	captchaVerifier, err := captcha.New(getEnv)
+	if err != nil {
+		return err
+	}
+	senderBlocklist, err := blocklist.New(getEnv)
+	if err != nil {
+		return err
+	}
+	handlePostEmail, err := email.HandlePostEmail(mailTransport, captchaVerifier, senderBlocklist, getEnv)
+	if err != nil {
+		return err
+	}
+	rateLimitStore, err := store.New(getEnv, "RATE_LIMIT")
+	if err != nil {
+		return err
+	}
+	isAllowed := func(request *http.Request) bool {
+		return senderBlocklist.AllowsIp(request.RemoteAddr)
+	}
+	serveMux.Handle("POST /api/email", middleware.RateLimit(handlePostEmail, rateLimitStore, isAllowed, getEnv))
+	serveMux.HandleFunc("GET /api/email/token", email.HandleGetFormToken(getEnv))
+	if challenger, ok := captchaVerifier.(captcha.Challenger); ok {
+		serveMux.HandleFunc("GET /api/email/captcha", challenger.HandleGetChallenge)
+	}
+	return nil
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"portfolio-back/config"
+)
+
+func serveHttp(
+	appContext context.Context,
+	shutdownWaitGroup *sync.WaitGroup,
+	handler http.Handler,
+	getEnv func(string) string,
+) {
+	server := NewHttpServer(handler, getEnv)
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		log.Fatalf("[FATAL] Failed to listen on %s: %s\n", server.Addr, err)
+	}
+	StartHttpServer(appContext, shutdownWaitGroup, server, listener, getEnv)
+}
+
+func NewHttpServer(handler http.Handler, getEnv func(string) string) *http.Server {
+	return &http.Server{
+		Addr:         config.String(getEnv, "HTTP_LISTEN_ADDRESS", ":8080"),
+		Handler:      handler,
+		ReadTimeout:  config.Milliseconds(getEnv, "HTTP_READ_TIMEOUT", 10*time.Second),
+		WriteTimeout: config.Milliseconds(getEnv, "HTTP_WRITE_TIMEOUT", 10*time.Second),
+		IdleTimeout:  config.Milliseconds(getEnv, "HTTP_IDLE_TIMEOUT", time.Minute),
+	}
+}
+
+// StartHttpServer serves requests from the listener in the background,
+// until the app context is cancelled and the server has shut down gracefully.
+func StartHttpServer(
+	appContext context.Context,
+	shutdownWaitGroup *sync.WaitGroup,
+	server *http.Server,
+	listener net.Listener,
+	getEnv func(string) string,
+) {
+	shutdownTimeout := config.Milliseconds(getEnv, "HTTP_SHUTDOWN_TIMEOUT", 10*time.Second)
+
+	shutdownWaitGroup.Add(1)
+	go func() {
+		log.Printf("[INFO] HTTP server listening on %s\n", listener.Addr())
+		err := server.Serve(listener)
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("[FATAL] HTTP server crashed: %s\n", err)
+		}
+	}()
+
+	go func() {
+		<-appContext.Done()
+		log.Println("[INFO] Shutting down HTTP server")
+		shutdownContext, freeContext := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer freeContext()
+		err := server.Shutdown(shutdownContext)
+		if err != nil {
+			log.Printf("[ERROR] HTTP server shutdown failed: %s\n", err)
+		}
+		shutdownWaitGroup.Done()
+	}()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHttpServerServesHandler(t *testing.T) {
+	handler := func(response http.ResponseWriter, _ *http.Request) {
+		response.WriteHeader(http.StatusTeapot)
+	}
+
+	serverUrl, shutdownWaitGroup, triggerShutdown := setupStandaloneHttpServer(handler)
+	defer teardownStandaloneHttpServer(shutdownWaitGroup, triggerShutdown)
+
+	response, err := http.Get(serverUrl)
+	require.Nil(t, err, "Request failed: %s\n", err)
+	assert.Equal(t, http.StatusTeapot, response.StatusCode)
+}
+
+func TestHttpServerShutsDownWithApp(t *testing.T) {
+	handler := func(_ http.ResponseWriter, _ *http.Request) {}
+
+	serverUrl, shutdownWaitGroup, triggerShutdown := setupStandaloneHttpServer(handler)
+	teardownStandaloneHttpServer(shutdownWaitGroup, triggerShutdown)
+
+	_, err := http.Get(serverUrl)
+	assert.NotNil(t, err)
+}
+
+func TestHttpServerConfiguration(t *testing.T) {
+	mockGetEnv := func(key string) string {
+		switch key {
+		case "HTTP_LISTEN_ADDRESS":
+			return "127.0.0.1:3000"
+		case "HTTP_READ_TIMEOUT":
+			return "1000"
+		default:
+			return ""
+		}
+	}
+
+	server := NewHttpServer(http.NotFoundHandler(), mockGetEnv)
+	assert.Equal(t, "127.0.0.1:3000", server.Addr)
+	assert.Equal(t, 1000, int(server.ReadTimeout.Milliseconds()))
+	assert.Equal(t, 10000, int(server.WriteTimeout.Milliseconds()))
+}
+
+func setupStandaloneHttpServer(handler http.HandlerFunc) (string, *sync.WaitGroup, func()) {
+	appContext, triggerShutdown := context.WithCancel(context.Background())
+	shutdownWaitGroup := &sync.WaitGroup{}
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		log.Panicf("Failed to start TCP listener for HTTP server: %s\n", err)
+	}
+	server := NewHttpServer(handler, func(string) string { return "" })
+	StartHttpServer(appContext, shutdownWaitGroup, server, listener, func(string) string { return "" })
+	return "http://" + listener.Addr().String(), shutdownWaitGroup, triggerShutdown
+}
+
+func teardownStandaloneHttpServer(shutdownWaitGroup *sync.WaitGroup, triggerShutdown func()) {
+	triggerShutdown()
+	shutdownWaitGroup.Wait()
+}
@@ -0,0 +1,166 @@
+package smtpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/smtp"
+	"slices"
+	"strings"
+)
+
+const (
+	// Picks the preferred mechanism among the ones advertised by the SMTP server.
+	AuthMechanismAuto    = ""
+	AuthMechanismNone    = "NONE"
+	AuthMechanismPlain   = "PLAIN"
+	AuthMechanismLogin   = "LOGIN"
+	AuthMechanismCramMd5 = "CRAM-MD5"
+	AuthMechanismXOAuth2 = "XOAUTH2"
+)
+
+// Mechanisms tried in order when picking from the ones advertised by the SMTP server.
+var preferredAuthMechanisms = []string{
+	AuthMechanismXOAuth2,
+	AuthMechanismPlain,
+	AuthMechanismLogin,
+	AuthMechanismCramMd5,
+}
+
+func parseAuthMechanism(rawMechanism string) (string, error) {
+	switch mechanism := strings.ToUpper(rawMechanism); mechanism {
+	case "", "AUTO":
+		return AuthMechanismAuto, nil
+	case AuthMechanismNone:
+		return mechanism, nil
+	default:
+		if !slices.Contains(preferredAuthMechanisms, mechanism) {
+			return "", fmt.Errorf("unknown SMTP authentication mechanism %q", rawMechanism)
+		}
+		return mechanism, nil
+	}
+}
+
+// authenticate authenticates the client with the configured mechanism,
+// or with the preferred one among those advertised by the SMTP server.
+func authenticate(ctx context.Context, client *smtp.Client, config *Config) error {
+	if config.AuthMechanism == AuthMechanismNone {
+		return nil
+	}
+	supported, advertised := client.Extension("AUTH")
+	if !supported {
+		return errors.New("SMTP server does not support authentication")
+	}
+	advertisedMechanisms := strings.Fields(strings.ToUpper(advertised))
+
+	mechanism := config.AuthMechanism
+	if mechanism == AuthMechanismAuto {
+		mechanism = pickAuthMechanism(advertisedMechanisms, config.OAuthTokenSource != nil)
+		if mechanism == "" {
+			return fmt.Errorf("no supported SMTP authentication mechanism among %q", advertised)
+		}
+	} else if !slices.Contains(advertisedMechanisms, mechanism) {
+		return fmt.Errorf("SMTP authentication mechanism %s is not among %q", mechanism, advertised)
+	}
+
+	auth, err := newAuth(ctx, mechanism, config)
+	if err != nil {
+		return err
+	}
+	return client.Auth(auth)
+}
+
+func pickAuthMechanism(advertisedMechanisms []string, hasOAuth bool) string {
+	for _, mechanism := range preferredAuthMechanisms {
+		if mechanism == AuthMechanismXOAuth2 && !hasOAuth {
+			continue
+		}
+		if slices.Contains(advertisedMechanisms, mechanism) {
+			return mechanism
+		}
+	}
+	return ""
+}
+
+func newAuth(ctx context.Context, mechanism string, config *Config) (smtp.Auth, error) {
+	switch mechanism {
+	case AuthMechanismPlain:
+		return smtp.PlainAuth("", config.Username, config.Password, config.ServerHost), nil
+	case AuthMechanismLogin:
+		return &loginAuth{username: config.Username, password: config.Password, host: config.ServerHost}, nil
+	case AuthMechanismCramMd5:
+		return smtp.CRAMMD5Auth(config.Username, config.Password), nil
+	case AuthMechanismXOAuth2:
+		if config.OAuthTokenSource == nil {
+			return nil, errors.New("XOAUTH2 authentication requires an OAuth token endpoint")
+		}
+		accessToken, err := config.OAuthTokenSource.Token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get OAuth access token: %w", err)
+		}
+		return &xoauth2Auth{username: config.Username, accessToken: accessToken, host: config.ServerHost}, nil
+	default:
+		return nil, fmt.Errorf("unknown SMTP authentication mechanism %q", mechanism)
+	}
+}
+
+// requireEncryption refuses to send credentials in plaintext, except to the local host,
+// like smtp.PlainAuth does.
+func requireEncryption(server *smtp.ServerInfo, host string) error {
+	if server.Name != host {
+		return errors.New("wrong host name")
+	}
+	if !server.TLS && !isLocalHost(server.Name) {
+		return errors.New("unencrypted connection")
+	}
+	return nil
+}
+
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+func (auth *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if err := requireEncryption(server, auth.host); err != nil {
+		return "", nil, err
+	}
+	return AuthMechanismLogin, nil, nil
+}
+
+func (auth *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+	switch prompt := strings.ToLower(strings.TrimSpace(string(fromServer))); prompt {
+	case "username:":
+		return []byte(auth.username), nil
+	case "password:":
+		return []byte(auth.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN prompt %q", prompt)
+	}
+}
+
+type xoauth2Auth struct {
+	username    string
+	accessToken string
+	host        string
+}
+
+func (auth *xoauth2Auth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if err := requireEncryption(server, auth.host); err != nil {
+		return "", nil, err
+	}
+	initialResponse := "user=" + auth.username + "\x01auth=Bearer " + auth.accessToken + "\x01\x01"
+	return AuthMechanismXOAuth2, []byte(initialResponse), nil
+}
+
+func (auth *xoauth2Auth) Next(_ []byte, more bool) ([]byte, error) {
+	if more {
+		// The server sent error details, and expects an empty response before failing.
+		return []byte{}, nil
+	}
+	return nil, nil
+}
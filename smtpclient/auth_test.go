@@ -0,0 +1,184 @@
+package smtpclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAuthMechanism(t *testing.T) {
+	for rawMechanism, expectedMechanism := range map[string]string{
+		"":         AuthMechanismAuto,
+		"auto":     AuthMechanismAuto,
+		"none":     AuthMechanismNone,
+		"login":    AuthMechanismLogin,
+		"CRAM-MD5": AuthMechanismCramMd5,
+		"xoauth2":  AuthMechanismXOAuth2,
+	} {
+		mechanism, err := parseAuthMechanism(rawMechanism)
+		assert.Nil(t, err)
+		assert.Equal(t, expectedMechanism, mechanism)
+	}
+
+	_, err := parseAuthMechanism("DIGEST-MD5")
+	assert.NotNil(t, err)
+}
+
+func TestPickAuthMechanism(t *testing.T) {
+	assert.Equal(t, AuthMechanismPlain, pickAuthMechanism([]string{"CRAM-MD5", "LOGIN", "PLAIN", "XOAUTH2"}, false))
+	assert.Equal(t, AuthMechanismXOAuth2, pickAuthMechanism([]string{"CRAM-MD5", "LOGIN", "PLAIN", "XOAUTH2"}, true))
+	assert.Equal(t, AuthMechanismLogin, pickAuthMechanism([]string{"CRAM-MD5", "LOGIN"}, false))
+	assert.Equal(t, AuthMechanismCramMd5, pickAuthMechanism([]string{"CRAM-MD5"}, true))
+	assert.Equal(t, "", pickAuthMechanism([]string{"XOAUTH2"}, false))
+}
+
+func TestLoginAuth(t *testing.T) {
+	auth := &loginAuth{username: "source@test.com", password: "test password", host: "smtp.test.com"}
+
+	mechanism, initialResponse, err := auth.Start(&smtp.ServerInfo{Name: "smtp.test.com", TLS: true})
+	require.Nil(t, err)
+	assert.Equal(t, "LOGIN", mechanism)
+	assert.Nil(t, initialResponse)
+
+	username, err := auth.Next([]byte("Username:"), true)
+	assert.Nil(t, err)
+	assert.Equal(t, "source@test.com", string(username))
+	password, err := auth.Next([]byte("Password:"), true)
+	assert.Nil(t, err)
+	assert.Equal(t, "test password", string(password))
+	_, err = auth.Next([]byte("Favorite color:"), true)
+	assert.NotNil(t, err)
+}
+
+func TestXOAuth2Auth(t *testing.T) {
+	auth := &xoauth2Auth{username: "source@test.com", accessToken: "test token", host: "smtp.test.com"}
+
+	mechanism, initialResponse, err := auth.Start(&smtp.ServerInfo{Name: "smtp.test.com", TLS: true})
+	require.Nil(t, err)
+	assert.Equal(t, "XOAUTH2", mechanism)
+	assert.Equal(t, "user=source@test.com\x01auth=Bearer test token\x01\x01", string(initialResponse))
+
+	response, err := auth.Next([]byte(`{"status":"401"}`), true)
+	assert.Nil(t, err)
+	assert.Empty(t, response)
+}
+
+func TestAuthRefusesUnencryptedRemoteServer(t *testing.T) {
+	unencryptedServer := &smtp.ServerInfo{Name: "smtp.test.com", TLS: false}
+	_, _, err := (&loginAuth{host: "smtp.test.com"}).Start(unencryptedServer)
+	assert.NotNil(t, err)
+	_, _, err = (&xoauth2Auth{host: "smtp.test.com"}).Start(unencryptedServer)
+	assert.NotNil(t, err)
+
+	_, _, err = (&loginAuth{host: "localhost"}).Start(&smtp.ServerInfo{Name: "localhost", TLS: false})
+	assert.Nil(t, err)
+}
+
+func TestOAuthTokenSourceCachesToken(t *testing.T) {
+	var tokenRequestCount atomic.Uint32
+	tokenEndpoint := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		tokenRequestCount.Add(1)
+		assert.Nil(t, request.ParseForm())
+		assert.Equal(t, "refresh_token", request.PostForm.Get("grant_type"))
+		assert.Equal(t, "test refresh token", request.PostForm.Get("refresh_token"))
+		assert.Equal(t, "test client", request.PostForm.Get("client_id"))
+		assert.Equal(t, "test secret", request.PostForm.Get("client_secret"))
+		response.Header().Set("Content-Type", "application/json")
+		response.Write([]byte(`{"access_token":"test token","expires_in":3600,"token_type":"Bearer"}`))
+	}))
+	defer tokenEndpoint.Close()
+
+	tokenSource := NewOAuthTokenSource(tokenEndpoint.URL, "test client", "test secret", "test refresh token")
+	for range 2 {
+		accessToken, err := tokenSource.Token(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, "test token", accessToken)
+	}
+	assert.Equal(t, 1, int(tokenRequestCount.Load()))
+}
+
+func TestOAuthTokenSourceRefreshesExpiredToken(t *testing.T) {
+	var tokenRequestCount atomic.Uint32
+	tokenEndpoint := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+		tokenRequestCount.Add(1)
+		response.Write([]byte(`{"access_token":"test token","expires_in":3600}`))
+	}))
+	defer tokenEndpoint.Close()
+
+	tokenSource := NewOAuthTokenSource(tokenEndpoint.URL, "test client", "test secret", "test refresh token")
+	_, err := tokenSource.Token(context.Background())
+	assert.Nil(t, err)
+	tokenSource.expiresAt = time.Now().Add(-time.Second)
+	_, err = tokenSource.Token(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, 2, int(tokenRequestCount.Load()))
+}
+
+func TestOAuthTokenCacheDuration(t *testing.T) {
+	for expiresIn, expected := range map[int]time.Duration{
+		3600: 59 * time.Minute,
+		120:  time.Minute,
+		30:   15 * time.Second,
+		0:    defaultTokenLifetime,
+		-1:   defaultTokenLifetime,
+	} {
+		assert.Equal(t, expected, tokenCacheDuration(expiresIn), "Unexpected cache duration for expires_in %d", expiresIn)
+	}
+}
+
+func TestOAuthTokenSourceFailsOnEmptyResponse(t *testing.T) {
+	for _, body := range []string{`null`, `{}`} {
+		tokenEndpoint := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+			response.Write([]byte(body))
+		}))
+
+		tokenSource := NewOAuthTokenSource(tokenEndpoint.URL, "test client", "test secret", "test refresh token")
+		_, err := tokenSource.Token(context.Background())
+		assert.ErrorContains(t, err, "no access token", "Unexpected error for %s", body)
+		tokenEndpoint.Close()
+	}
+}
+
+func TestOAuthTokenSourceFailsOnErrorResponse(t *testing.T) {
+	tokenEndpoint := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+		http.Error(response, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+	}))
+	defer tokenEndpoint.Close()
+
+	tokenSource := NewOAuthTokenSource(tokenEndpoint.URL, "test client", "test secret", "test refresh token")
+	_, err := tokenSource.Token(context.Background())
+	assert.NotNil(t, err)
+}
+
+func TestExplicitAuthMechanismMustBeAdvertised(t *testing.T) {
+	smtpServer := newTlsTestSmtpServer()
+	smtpServer.AuthMechs = map[string]bool{"PLAIN": true, "LOGIN": false}
+	smtpServerPort := serveSmtp(smtpServer, false)
+	defer teardownSmtpServer(smtpServer)
+
+	config := newTlsTestConfig(smtpServerPort, TlsModeStartTls, newTestTlsConfig())
+	config.AuthMechanism = AuthMechanismLogin
+	_, err := dial(context.Background(), config)
+	assert.NotNil(t, err)
+}
+
+func TestNoAuthentication(t *testing.T) {
+	smtpServer := newTlsTestSmtpServer()
+	smtpServer.AuthHandler = nil
+	smtpServerPort := serveSmtp(smtpServer, false)
+	defer teardownSmtpServer(smtpServer)
+
+	config := newTlsTestConfig(smtpServerPort, TlsModeStartTls, newTestTlsConfig())
+	_, err := dial(context.Background(), config)
+	assert.NotNil(t, err)
+
+	config.AuthMechanism = AuthMechanismNone
+	assertDialSucceeds(t, config)
+}
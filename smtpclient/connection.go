@@ -0,0 +1,187 @@
+package smtpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"time"
+
+	"portfolio-back/config"
+)
+
+type Config struct {
+	ClientDomain string
+	ServerHost   string
+	ServerPort   string
+	TlsMode      TlsMode
+	TlsConfig    *tls.Config
+
+	Username string
+	Password string
+	// One of the AuthMechanism constants.
+	AuthMechanism    string
+	OAuthTokenSource *OAuthTokenSource
+
+	DialAttempts int
+	DialBackoff  time.Duration
+	// Bounds the commands which are not tied to a request, such as health checks.
+	CommandTimeout time.Duration
+
+	PoolMinSize         int
+	PoolMaxSize         int
+	PoolIdleTimeout     time.Duration
+	PoolHealthCheckIdle time.Duration
+}
+
+func LoadConfig(getEnv func(string) string) (*Config, error) {
+	serverHost := getEnv("SMTP_SERVER_DOMAIN")
+	tlsMode, err := parseTlsMode(getEnv("SMTP_TLS_MODE"), serverHost)
+	if err != nil {
+		return nil, err
+	}
+	authMechanism, err := parseAuthMechanism(getEnv("SMTP_AUTH_MECHANISM"))
+	if err != nil {
+		return nil, err
+	}
+	var oauthTokenSource *OAuthTokenSource
+	if tokenUrl := getEnv("SMTP_OAUTH_TOKEN_URL"); tokenUrl != "" {
+		oauthTokenSource = NewOAuthTokenSource(
+			tokenUrl,
+			getEnv("SMTP_OAUTH_CLIENT_ID"),
+			getEnv("SMTP_OAUTH_CLIENT_SECRET"),
+			getEnv("SMTP_OAUTH_REFRESH_TOKEN"),
+		)
+	}
+	tlsConfig, err := loadTlsConfig(
+		serverHost,
+		getEnv("SMTP_TLS_CA_FILE"),
+		getEnv("SMTP_TLS_CLIENT_CERT_FILE"),
+		getEnv("SMTP_TLS_CLIENT_KEY_FILE"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Config{
+		ClientDomain: getEnv("SMTP_CLIENT_DOMAIN"),
+		ServerHost:   serverHost,
+		ServerPort:   getEnv("SMTP_SERVER_PORT"),
+		TlsMode:      tlsMode,
+		TlsConfig:    tlsConfig,
+
+		Username:         getEnv("SOURCE_EMAIL_ADDRESS"),
+		Password:         getEnv("SOURCE_EMAIL_PASSWORD"),
+		AuthMechanism:    authMechanism,
+		OAuthTokenSource: oauthTokenSource,
+
+		DialAttempts:   max(1, config.Int(getEnv, "SMTP_DIAL_ATTEMPTS", 3)),
+		DialBackoff:    config.Milliseconds(getEnv, "SMTP_DIAL_BACKOFF", 100*time.Millisecond),
+		CommandTimeout: config.Milliseconds(getEnv, "SMTP_COMMAND_TIMEOUT", 5*time.Second),
+
+		PoolMinSize:         max(0, config.Int(getEnv, "SMTP_POOL_MIN_SIZE", 0)),
+		PoolMaxSize:         max(1, config.Int(getEnv, "SMTP_POOL_MAX_SIZE", 4)),
+		PoolIdleTimeout:     config.Milliseconds(getEnv, "SMTP_POOL_IDLE_TIMEOUT", time.Minute),
+		PoolHealthCheckIdle: config.Milliseconds(getEnv, "SMTP_POOL_HEALTH_CHECK_IDLE", 5*time.Second),
+	}, nil
+}
+
+func (config *Config) ServerName() string {
+	return net.JoinHostPort(config.ServerHost, config.ServerPort)
+}
+
+// dialWithBackoff establishes an authenticated SMTP session.
+// Failing dials are retried with exponential backoff, until the context is done.
+func dialWithBackoff(ctx context.Context, config *Config) (session *Session, err error) {
+	backoff := config.DialBackoff
+	for attempt := 1; ; attempt++ {
+		log.Println("[INFO] Setting up SMTP client")
+		session, err = dial(ctx, config)
+		if err == nil {
+			log.Println("[INFO] SMTP client is ready")
+			return
+		}
+		log.Printf("[ERROR] SMTP client setup failed (attempt %d/%d): %s\n", attempt, config.DialAttempts, err)
+		if attempt >= config.DialAttempts {
+			return
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// IsConnectionError reports whether err means that the SMTP connection is no longer usable.
+func IsConnectionError(err error) bool {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var protocolErr *textproto.Error
+	return errors.As(err, &protocolErr) && protocolErr.Code == 421
+}
+
+func dial(ctx context.Context, config *Config) (*Session, error) {
+	conn, err := dialConn(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	session := &Session{conn: conn}
+	err = session.withContext(ctx, func() (err error) {
+		log.Println("[DEBUG] Creating SMTP client")
+		session.client, err = smtp.NewClient(conn, config.ServerHost)
+		if err != nil {
+			return
+		}
+		log.Println("[DEBUG] Sending HELLO to SMTP server")
+		if err = session.client.Hello(config.ClientDomain); err != nil {
+			return
+		}
+		if err = startTls(session.client, config); err != nil {
+			return
+		}
+		log.Println("[DEBUG] Authenticating to the SMTP server")
+		return authenticate(ctx, session.client, config)
+	})
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return session, nil
+}
+
+func dialConn(ctx context.Context, config *Config) (net.Conn, error) {
+	if config.TlsMode == TlsModeImplicit {
+		log.Println("[DEBUG] Establishing TLS connection with SMTP server")
+		dialer := &tls.Dialer{Config: config.TlsConfig}
+		return dialer.DialContext(ctx, "tcp", config.ServerName())
+	}
+	log.Println("[DEBUG] Establishing TCP connection with SMTP server")
+	dialer := &net.Dialer{}
+	return dialer.DialContext(ctx, "tcp", config.ServerName())
+}
+
+func startTls(client *smtp.Client, config *Config) error {
+	switch config.TlsMode {
+	case TlsModeStartTls:
+	case TlsModeOpportunistic:
+		if supported, _ := client.Extension("STARTTLS"); !supported {
+			log.Println("[WARN] SMTP server does not support STARTTLS, communicating in plaintext")
+			return nil
+		}
+	default:
+		return nil
+	}
+	log.Println("[DEBUG] Negotiating TLS encryption for SMTP communication")
+	return client.StartTLS(config.TlsConfig)
+}
@@ -0,0 +1,51 @@
+package smtpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsConnectionError(t *testing.T) {
+	assert.True(t, IsConnectionError(io.EOF))
+	assert.True(t, IsConnectionError(fmt.Errorf("wrapped: %w", io.ErrUnexpectedEOF)))
+	assert.True(t, IsConnectionError(&net.OpError{Op: "write", Err: errors.New("broken pipe")}))
+	assert.True(t, IsConnectionError(&textproto.Error{Code: 421, Msg: "Service closing transmission channel"}))
+	assert.False(t, IsConnectionError(&textproto.Error{Code: 550, Msg: "Mailbox unavailable"}))
+	assert.False(t, IsConnectionError(errors.New("some error")))
+	assert.False(t, IsConnectionError(nil))
+}
+
+func TestDialRetriesWithBackoff(t *testing.T) {
+	startedAt := time.Now()
+	client, err := dialWithBackoff(context.Background(), newUnreachableServerConfig(3, 10*time.Millisecond))
+	assert.Nil(t, client)
+	assert.NotNil(t, err)
+	assert.GreaterOrEqual(t, time.Since(startedAt), 30*time.Millisecond)
+}
+
+func TestDialStopsRetryingWhenContextDone(t *testing.T) {
+	ctx, freeContext := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer freeContext()
+	_, err := dialWithBackoff(ctx, newUnreachableServerConfig(3, time.Hour))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func newUnreachableServerConfig(dialAttempts int, dialBackoff time.Duration) *Config {
+	listener, _ := net.Listen("tcp", "localhost:0")
+	listener.Close()
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	return &Config{
+		ServerHost:   host,
+		ServerPort:   port,
+		DialAttempts: dialAttempts,
+		DialBackoff:  dialBackoff,
+	}
+}
@@ -0,0 +1,114 @@
+package smtpclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Access tokens are refreshed a bit before they expire, so that they remain valid while in use.
+const tokenExpiryMargin = time.Minute
+
+// Access tokens whose lifetime the token endpoint does not tell are cached briefly,
+// as using one past its expiry fails authentication.
+const defaultTokenLifetime = 5 * time.Minute
+
+// OAuthTokenSource gets access tokens for XOAUTH2 authentication from an OAuth 2.0 token endpoint,
+// using the refresh token grant, and caches them until they expire.
+type OAuthTokenSource struct {
+	tokenUrl     string
+	clientId     string
+	clientSecret string
+	refreshToken string
+	httpClient   *http.Client
+
+	mutex       sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+func NewOAuthTokenSource(tokenUrl string, clientId string, clientSecret string, refreshToken string) *OAuthTokenSource {
+	return &OAuthTokenSource{
+		tokenUrl:     tokenUrl,
+		clientId:     clientId,
+		clientSecret: clientSecret,
+		refreshToken: refreshToken,
+		httpClient:   &http.Client{},
+	}
+}
+
+func (source *OAuthTokenSource) Token(ctx context.Context) (string, error) {
+	source.mutex.Lock()
+	defer source.mutex.Unlock()
+	if source.accessToken != "" && time.Now().Before(source.expiresAt) {
+		return source.accessToken, nil
+	}
+
+	log.Println("[INFO] Refreshing OAuth access token for SMTP authentication")
+	token, err := source.requestToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	source.accessToken = token.AccessToken
+	source.expiresAt = time.Now().Add(tokenCacheDuration(token.ExpiresIn))
+	return source.accessToken, nil
+}
+
+// tokenCacheDuration keeps tokens shorter-lived than the margin for half of their lifetime,
+// rather than refreshing them for every connection.
+func tokenCacheDuration(expiresIn int) time.Duration {
+	lifetime := time.Duration(expiresIn) * time.Second
+	switch {
+	case expiresIn <= 0:
+		return defaultTokenLifetime
+	case lifetime <= 2*tokenExpiryMargin:
+		return lifetime / 2
+	default:
+		return lifetime - tokenExpiryMargin
+	}
+}
+
+func (source *OAuthTokenSource) requestToken(ctx context.Context) (*tokenResponse, error) {
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {source.refreshToken},
+		"client_id":     {source.clientId},
+		"client_secret": {source.clientSecret},
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, source.tokenUrl, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Set("Accept", "application/json")
+
+	response, err := source.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint responded with status %s", response.Status)
+	}
+
+	var token tokenResponse
+	err = json.NewDecoder(response.Body).Decode(&token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token endpoint response: %w", err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("token endpoint response has no access token")
+	}
+	return &token, nil
+}
@@ -0,0 +1,248 @@
+package smtpclient
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+var ErrPoolClosed = errors.New("SMTP session pool is closed")
+
+type idleSession struct {
+	session   *Session
+	idleSince time.Time
+}
+
+// Pool manages a bounded set of authenticated SMTP sessions, dialed on demand.
+// Each session obtained with Get must be handed back with Release.
+type Pool struct {
+	config *Config
+	// Holds one token per open session, whether idle or in use.
+	slots chan struct{}
+	idle  chan *idleSession
+
+	mutex       sync.Mutex
+	inUse       map[*Session]struct{}
+	closed      bool
+	stopEvictor chan struct{}
+}
+
+func NewPool(config *Config) *Pool {
+	pool := &Pool{
+		config:      config,
+		slots:       make(chan struct{}, config.PoolMaxSize),
+		idle:        make(chan *idleSession, config.PoolMaxSize),
+		inUse:       make(map[*Session]struct{}),
+		stopEvictor: make(chan struct{}),
+	}
+	go pool.maintainIdleSessions()
+	return pool
+}
+
+// Get returns an idle SMTP session if there is a healthy one,
+// dials a new one if the pool is not full, or waits for a session to be released.
+func (pool *Pool) Get(ctx context.Context) (*Session, error) {
+	if pool.isClosed() {
+		return nil, ErrPoolClosed
+	}
+	for {
+		select {
+		case idleSession := <-pool.idle:
+			if pool.isHealthy(idleSession) {
+				return pool.use(idleSession.session), nil
+			}
+			continue
+		default:
+		}
+
+		select {
+		case idleSession := <-pool.idle:
+			if pool.isHealthy(idleSession) {
+				return pool.use(idleSession.session), nil
+			}
+		case pool.slots <- struct{}{}:
+			session, err := dialWithBackoff(ctx, pool.config)
+			if err != nil {
+				<-pool.slots
+				return nil, err
+			}
+			return pool.use(session), nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Release hands back a session, given the outcome of its last operation.
+// Sessions in an unknown protocol state are discarded, while the others are reset and reused.
+func (pool *Pool) Release(session *Session, err error) {
+	if session.Broken() {
+		pool.discard(session)
+		return
+	}
+	if err != nil {
+		resetContext, freeContext := context.WithTimeout(context.Background(), pool.config.CommandTimeout)
+		defer freeContext()
+		if resetErr := session.Reset(resetContext); resetErr != nil {
+			log.Printf("[WARN] Failed to reset SMTP session: %s\n", resetErr)
+			pool.discard(session)
+			return
+		}
+	}
+	pool.putIdle(&idleSession{session: session, idleSince: time.Now()})
+}
+
+// Close shuts down the idle sessions, and interrupts the sessions in use.
+func (pool *Pool) Close() {
+	for _, session := range pool.shutDown() {
+		pool.quit(session)
+	}
+}
+
+// shutDown marks the pool as closed and interrupts the sessions in use,
+// returning the idle sessions so that they can be quit without holding the lock.
+func (pool *Pool) shutDown() []*Session {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	if pool.closed {
+		return nil
+	}
+	pool.closed = true
+	close(pool.stopEvictor)
+	for session := range pool.inUse {
+		log.Println("[INFO] Interrupting SMTP session in use")
+		session.Close()
+	}
+	var idleSessions []*Session
+	for {
+		select {
+		case idleSession := <-pool.idle:
+			idleSessions = append(idleSessions, idleSession.session)
+		default:
+			return idleSessions
+		}
+	}
+}
+
+func (pool *Pool) discard(session *Session) {
+	log.Println("[INFO] Discarding SMTP session")
+	pool.mutex.Lock()
+	delete(pool.inUse, session)
+	pool.mutex.Unlock()
+	session.Close()
+	<-pool.slots
+}
+
+func (pool *Pool) quit(session *Session) {
+	log.Println("[INFO] Shutting down SMTP session")
+	quitContext, freeContext := context.WithTimeout(context.Background(), pool.config.CommandTimeout)
+	defer freeContext()
+	err := session.Quit(quitContext)
+	if err != nil {
+		log.Printf("[ERROR] SMTP session shutdown failed: %s\n", err)
+	}
+	<-pool.slots
+}
+
+func (pool *Pool) putIdle(idleSession *idleSession) {
+	pool.mutex.Lock()
+	delete(pool.inUse, idleSession.session)
+	closed := pool.closed
+	if !closed {
+		pool.idle <- idleSession
+	}
+	pool.mutex.Unlock()
+	if closed {
+		pool.quit(idleSession.session)
+	}
+}
+
+func (pool *Pool) isClosed() bool {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	return pool.closed
+}
+
+func (pool *Pool) use(session *Session) *Session {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	pool.inUse[session] = struct{}{}
+	return session
+}
+
+// isHealthy checks that a session which has been idle for a while is still connected,
+// and discards it otherwise.
+func (pool *Pool) isHealthy(idleSession *idleSession) bool {
+	if time.Since(idleSession.idleSince) < pool.config.PoolHealthCheckIdle {
+		return true
+	}
+	noopContext, freeContext := context.WithTimeout(context.Background(), pool.config.CommandTimeout)
+	defer freeContext()
+	err := idleSession.session.Noop(noopContext)
+	if err == nil {
+		return true
+	}
+	log.Printf("[WARN] Idle SMTP session failed health check: %s\n", err)
+	pool.discard(idleSession.session)
+	return false
+}
+
+// maintainIdleSessions periodically evicts the sessions which have been idle for too long,
+// and dials new ones to keep at least the minimum pool size open.
+func (pool *Pool) maintainIdleSessions() {
+	ticker := time.NewTicker(max(pool.config.PoolIdleTimeout/2, time.Millisecond))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			pool.evictIdleSessions()
+			pool.fillToMinSize()
+		case <-pool.stopEvictor:
+			return
+		}
+	}
+}
+
+func (pool *Pool) evictIdleSessions() {
+	var idleSessions []*idleSession
+	for collecting := true; collecting; {
+		select {
+		case idleSession := <-pool.idle:
+			idleSessions = append(idleSessions, idleSession)
+		default:
+			collecting = false
+		}
+	}
+
+	openCount := len(pool.slots)
+	for _, idleSession := range idleSessions {
+		if openCount > pool.config.PoolMinSize && time.Since(idleSession.idleSince) >= pool.config.PoolIdleTimeout {
+			log.Println("[INFO] Evicting idle SMTP session")
+			openCount--
+			pool.quit(idleSession.session)
+		} else {
+			pool.putIdle(idleSession)
+		}
+	}
+}
+
+func (pool *Pool) fillToMinSize() {
+	for len(pool.slots) < pool.config.PoolMinSize {
+		select {
+		case pool.slots <- struct{}{}:
+		default:
+			return
+		}
+		dialContext, freeContext := context.WithTimeout(context.Background(), pool.config.CommandTimeout)
+		session, err := dial(dialContext, pool.config)
+		freeContext()
+		if err != nil {
+			log.Printf("[ERROR] SMTP session setup failed while filling the pool: %s\n", err)
+			<-pool.slots
+			return
+		}
+		pool.putIdle(&idleSession{session: session, idleSince: time.Now()})
+	}
+}
@@ -0,0 +1,291 @@
+package smtpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mhale/smtpd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPoolReusesIdleClient(t *testing.T) {
+	smtpServer, smtpServerPort, connSetupCount := setupSmtpServer(nil)
+	defer teardownSmtpServer(smtpServer)
+	pool := NewPool(newPoolConfig(smtpServerPort))
+	defer pool.Close()
+
+	client, err := pool.Get(context.Background())
+	require.Nil(t, err, "Failed to get SMTP session: %s\n", err)
+	pool.Release(client, nil)
+	reusedClient, err := pool.Get(context.Background())
+	require.Nil(t, err, "Failed to get SMTP session: %s\n", err)
+	pool.Release(reusedClient, nil)
+
+	assert.Same(t, client, reusedClient)
+	assert.Equal(t, 1, int(connSetupCount.Load()))
+}
+
+func TestPoolDialsUpToMaxSize(t *testing.T) {
+	smtpServer, smtpServerPort, connSetupCount := setupSmtpServer(nil)
+	defer teardownSmtpServer(smtpServer)
+	config := newPoolConfig(smtpServerPort)
+	config.PoolMaxSize = 2
+	pool := NewPool(config)
+	defer pool.Close()
+
+	firstClient, err := pool.Get(context.Background())
+	require.Nil(t, err, "Failed to get SMTP session: %s\n", err)
+	secondClient, err := pool.Get(context.Background())
+	require.Nil(t, err, "Failed to get SMTP session: %s\n", err)
+	assert.NotSame(t, firstClient, secondClient)
+
+	ctx, freeContext := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer freeContext()
+	_, err = pool.Get(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	pool.Release(firstClient, nil)
+	thirdClient, err := pool.Get(context.Background())
+	require.Nil(t, err, "Failed to get SMTP session: %s\n", err)
+	assert.Same(t, firstClient, thirdClient)
+	assert.Equal(t, 2, int(connSetupCount.Load()))
+
+	pool.Release(secondClient, nil)
+	pool.Release(thirdClient, nil)
+}
+
+func TestPoolDiscardsBrokenSession(t *testing.T) {
+	smtpServer, smtpServerPort, connSetupCount := setupSmtpServer(nil)
+	defer teardownSmtpServer(smtpServer)
+	config := newPoolConfig(smtpServerPort)
+	config.PoolMaxSize = 1
+	pool := NewPool(config)
+	defer pool.Close()
+
+	client, err := pool.Get(context.Background())
+	require.Nil(t, err, "Failed to get SMTP session: %s\n", err)
+	client.Close()
+	err = client.Send(context.Background(), "source@test.com", []string{"target@test.com"}, []byte("Test"))
+	assert.True(t, client.Broken())
+	pool.Release(client, err)
+	newClient, err := pool.Get(context.Background())
+	require.Nil(t, err, "Failed to get SMTP session: %s\n", err)
+	pool.Release(newClient, nil)
+
+	assert.NotSame(t, client, newClient)
+	assert.Equal(t, 2, int(connSetupCount.Load()))
+}
+
+func TestPoolEvictsIdleClients(t *testing.T) {
+	smtpServer, smtpServerPort, connSetupCount := setupSmtpServer(nil)
+	defer teardownSmtpServer(smtpServer)
+	config := newPoolConfig(smtpServerPort)
+	config.PoolIdleTimeout = 20 * time.Millisecond
+	pool := NewPool(config)
+	defer pool.Close()
+
+	client, err := pool.Get(context.Background())
+	require.Nil(t, err, "Failed to get SMTP session: %s\n", err)
+	pool.Release(client, nil)
+	time.Sleep(5 * config.PoolIdleTimeout)
+
+	assert.Equal(t, 0, len(pool.slots))
+	newClient, err := pool.Get(context.Background())
+	require.Nil(t, err, "Failed to get SMTP session: %s\n", err)
+	pool.Release(newClient, nil)
+	assert.Equal(t, 2, int(connSetupCount.Load()))
+}
+
+func TestPoolKeepsMinSizeOpen(t *testing.T) {
+	smtpServer, smtpServerPort, connSetupCount := setupSmtpServer(nil)
+	defer teardownSmtpServer(smtpServer)
+	config := newPoolConfig(smtpServerPort)
+	config.PoolMinSize = 2
+	config.PoolIdleTimeout = 20 * time.Millisecond
+	pool := NewPool(config)
+	defer pool.Close()
+
+	time.Sleep(5 * config.PoolIdleTimeout)
+
+	assert.Equal(t, 2, len(pool.slots))
+	assert.Equal(t, 2, int(connSetupCount.Load()))
+}
+
+func TestPoolHealthCheckDiscardsDeadClient(t *testing.T) {
+	smtpListener := &connRecorder{Listener: listenSmtp()}
+	smtpServer, smtpServerPort, connSetupCount := setupSmtpServerOn(nil, smtpListener)
+	defer teardownSmtpServer(smtpServer)
+	config := newPoolConfig(smtpServerPort)
+	config.PoolHealthCheckIdle = 0
+	pool := NewPool(config)
+	defer pool.Close()
+
+	client, err := pool.Get(context.Background())
+	require.Nil(t, err, "Failed to get SMTP session: %s\n", err)
+	pool.Release(client, nil)
+	smtpListener.dropConns()
+
+	newClient, err := pool.Get(context.Background())
+	require.Nil(t, err, "Failed to get SMTP session: %s\n", err)
+	pool.Release(newClient, nil)
+	assert.NotSame(t, client, newClient)
+	assert.Equal(t, 2, int(connSetupCount.Load()))
+}
+
+func TestPoolResetsSessionAfterReplyError(t *testing.T) {
+	smtpHandler := func(_ net.Addr, _ string, _ []string, _ []byte) error {
+		return errors.New("Error in SMTP server")
+	}
+	smtpServer, smtpServerPort, connSetupCount := setupSmtpServer(smtpHandler)
+	defer teardownSmtpServer(smtpServer)
+	pool := NewPool(newPoolConfig(smtpServerPort))
+	defer pool.Close()
+
+	for range 2 {
+		session, err := pool.Get(context.Background())
+		require.Nil(t, err, "Failed to get SMTP session: %s\n", err)
+		err = session.Send(context.Background(), "source@test.com", []string{"target@test.com"}, []byte("Test"))
+		assert.NotNil(t, err)
+		assert.False(t, session.Broken())
+		pool.Release(session, err)
+	}
+	assert.Equal(t, 1, int(connSetupCount.Load()))
+}
+
+func TestPoolInterruptsSessionsInUseOnClose(t *testing.T) {
+	smtpRequestReceived := make(chan struct{})
+	unlockSmtpServer := make(chan struct{})
+	smtpHandler := func(_ net.Addr, _ string, _ []string, _ []byte) error {
+		smtpRequestReceived <- struct{}{}
+		<-unlockSmtpServer
+		return nil
+	}
+	smtpServer, smtpServerPort, _ := setupSmtpServer(smtpHandler)
+	defer teardownSmtpServer(smtpServer)
+	defer close(unlockSmtpServer)
+	pool := NewPool(newPoolConfig(smtpServerPort))
+
+	session, err := pool.Get(context.Background())
+	require.Nil(t, err, "Failed to get SMTP session: %s\n", err)
+	go func() {
+		<-smtpRequestReceived
+		pool.Close()
+	}()
+	err = session.Send(context.Background(), "source@test.com", []string{"target@test.com"}, []byte("Test"))
+	assert.NotNil(t, err)
+	assert.True(t, session.Broken())
+	pool.Release(session, err)
+}
+
+func TestPoolRefusesSessionsOnceClosed(t *testing.T) {
+	pool := NewPool(newPoolConfig(0))
+	pool.Close()
+
+	_, err := pool.Get(context.Background())
+	assert.ErrorIs(t, err, ErrPoolClosed)
+}
+
+func newPoolConfig(smtpServerPort int) *Config {
+	return &Config{
+		ServerHost:          "localhost",
+		ServerPort:          strconv.Itoa(smtpServerPort),
+		TlsMode:             TlsModeStartTls,
+		TlsConfig:           newTestTlsConfig(),
+		DialAttempts:        1,
+		CommandTimeout:      time.Second,
+		PoolMaxSize:         4,
+		PoolIdleTimeout:     time.Minute,
+		PoolHealthCheckIdle: time.Minute,
+	}
+}
+
+func setupSmtpServer(handler smtpd.Handler) (*smtpd.Server, int, *atomic.Uint32) {
+	return setupSmtpServerOn(handler, listenSmtp())
+}
+
+func setupSmtpServerOn(handler smtpd.Handler, listener net.Listener) (*smtpd.Server, int, *atomic.Uint32) {
+	connSetupCount := &atomic.Uint32{}
+	smtpServer := &smtpd.Server{
+		Handler: handler,
+		AuthHandler: func(_ net.Addr, _ string, _ []byte, _ []byte, _ []byte) (bool, error) {
+			connSetupCount.Add(1)
+			return true, nil
+		},
+		TLSRequired: true,
+	}
+	configureTls(smtpServer)
+	return smtpServer, serveSmtpOn(smtpServer, listener, false), connSetupCount
+}
+
+func configureTls(smtpServer *smtpd.Server) {
+	err := smtpServer.ConfigureTLS("../smtp_test_server.crt", "../smtp_test_server.key")
+	if err != nil {
+		log.Panicf("Failed to configure TLS for SMTP server: %s\n", err)
+	}
+}
+
+func serveSmtp(smtpServer *smtpd.Server, implicitTls bool) int {
+	return serveSmtpOn(smtpServer, listenSmtp(), implicitTls)
+}
+
+func serveSmtpOn(smtpServer *smtpd.Server, listener net.Listener, implicitTls bool) int {
+	port := listener.Addr().(*net.TCPAddr).Port
+	if implicitTls {
+		listener = tls.NewListener(listener, smtpServer.TLSConfig)
+	}
+	go func() {
+		err := smtpServer.Serve(listener)
+		if !errors.Is(err, smtpd.ErrServerClosed) {
+			log.Panicf("SMTP server crashed: %s\n", err)
+		}
+	}()
+	return port
+}
+
+func listenSmtp() net.Listener {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		log.Panicf("Failed to start TCP listener for SMTP server: %s\n", err)
+	}
+	return listener
+}
+
+// connRecorder keeps track of the connections accepted by an SMTP server,
+// so that tests can drop them from the server side.
+type connRecorder struct {
+	net.Listener
+	mutex sync.Mutex
+	conns []net.Conn
+}
+
+func (listener *connRecorder) Accept() (net.Conn, error) {
+	conn, err := listener.Listener.Accept()
+	if err == nil {
+		listener.mutex.Lock()
+		listener.conns = append(listener.conns, conn)
+		listener.mutex.Unlock()
+	}
+	return conn, err
+}
+
+func (listener *connRecorder) dropConns() {
+	listener.mutex.Lock()
+	defer listener.mutex.Unlock()
+	for _, conn := range listener.conns {
+		conn.Close()
+	}
+	listener.conns = nil
+}
+
+func teardownSmtpServer(smtpServer *smtpd.Server) {
+	smtpServer.Shutdown(context.Background())
+}
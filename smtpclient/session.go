@@ -0,0 +1,119 @@
+package smtpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"time"
+)
+
+// Session is an SMTP client along with its underlying connection,
+// whose I/O is bounded by the deadline and cancellation of a context.
+type Session struct {
+	conn   net.Conn
+	client *smtp.Client
+	// Set once the connection is left in an unknown protocol state, and must not be reused.
+	broken bool
+}
+
+// Send performs a full MAIL/RCPT/DATA transaction.
+// If the context is done before the transaction completes, the I/O is interrupted.
+func (session *Session) Send(ctx context.Context, from string, to []string, message []byte) error {
+	return session.withContext(ctx, func() error {
+		log.Println("[DEBUG] Setting SMTP email sender")
+		if err := session.client.Mail(from); err != nil {
+			return err
+		}
+		log.Println("[DEBUG] Setting SMTP email receivers")
+		for _, receiver := range to {
+			if err := session.client.Rcpt(receiver); err != nil {
+				return err
+			}
+		}
+		log.Println("[DEBUG] Starting SMTP email body")
+		messageWriter, err := session.client.Data()
+		if err != nil {
+			return err
+		}
+		log.Println("[DEBUG] Writing SMTP email body")
+		if _, err = messageWriter.Write(message); err != nil {
+			return err
+		}
+		log.Println("[DEBUG] Sending SMTP email")
+		return messageWriter.Close()
+	})
+}
+
+// Reset aborts the current SMTP transaction, if any.
+func (session *Session) Reset(ctx context.Context) error {
+	return session.withContext(ctx, session.client.Reset)
+}
+
+func (session *Session) Noop(ctx context.Context) error {
+	return session.withContext(ctx, session.client.Noop)
+}
+
+// Quit gracefully ends the SMTP session, then closes the connection.
+func (session *Session) Quit(ctx context.Context) error {
+	err := session.withContext(ctx, session.client.Quit)
+	session.conn.Close()
+	return err
+}
+
+// Close abruptly closes the connection, interrupting any ongoing I/O.
+func (session *Session) Close() error {
+	return session.conn.Close()
+}
+
+// Broken reports whether the session failed in a way that leaves its protocol state unknown.
+func (session *Session) Broken() bool {
+	return session.broken
+}
+
+// withContext runs an SMTP operation with the context deadline applied to the connection,
+// and interrupts the connection I/O as soon as the context is cancelled.
+func (session *Session) withContext(ctx context.Context, operation func() error) error {
+	deadline, hasDeadline := ctx.Deadline()
+	if hasDeadline {
+		session.conn.SetDeadline(deadline)
+	}
+	interrupted := make(chan struct{})
+	stopInterrupting := context.AfterFunc(ctx, func() {
+		session.conn.SetDeadline(time.Unix(1, 0))
+		close(interrupted)
+	})
+
+	err := operation()
+	if !stopInterrupting() {
+		<-interrupted
+	}
+	session.conn.SetDeadline(time.Time{})
+
+	if err == nil {
+		return nil
+	}
+	if !isReplyError(err) {
+		session.broken = true
+	}
+	ctxErr := ctx.Err()
+	if ctxErr == nil && hasDeadline && errors.Is(err, os.ErrDeadlineExceeded) {
+		// The connection deadline may expire slightly before the context one.
+		ctxErr = context.DeadlineExceeded
+	}
+	if ctxErr != nil {
+		return fmt.Errorf("SMTP exchange interrupted: %w (%w)", ctxErr, err)
+	}
+	return err
+}
+
+// isReplyError reports whether err is a complete negative reply from the SMTP server,
+// after which the protocol state is still known.
+func isReplyError(err error) bool {
+	var protocolErr *textproto.Error
+	return errors.As(err, &protocolErr) && protocolErr.Code != 421
+}
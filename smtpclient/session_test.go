@@ -0,0 +1,75 @@
+package smtpclient
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSendIsInterruptedOnCancellation(t *testing.T) {
+	smtpRequestReceived := make(chan struct{})
+	unlockSmtpServer := make(chan struct{})
+	smtpHandler := func(_ net.Addr, _ string, _ []string, _ []byte) error {
+		smtpRequestReceived <- struct{}{}
+		<-unlockSmtpServer
+		return nil
+	}
+	smtpServer, smtpServerPort, _ := setupSmtpServer(smtpHandler)
+	defer teardownSmtpServer(smtpServer)
+	defer close(unlockSmtpServer)
+
+	session, err := dial(context.Background(), newPoolConfig(smtpServerPort))
+	require.Nil(t, err, "Failed to dial SMTP session: %s\n", err)
+	defer session.Close()
+
+	ctx, triggerCancellation := context.WithCancel(context.Background())
+	go func() {
+		<-smtpRequestReceived
+		triggerCancellation()
+	}()
+	err = session.Send(ctx, "source@test.com", []string{"target@test.com"}, []byte("Test"))
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.True(t, session.Broken())
+}
+
+func TestSendIsInterruptedOnDeadline(t *testing.T) {
+	unlockSmtpServer := make(chan struct{})
+	smtpHandler := func(_ net.Addr, _ string, _ []string, _ []byte) error {
+		<-unlockSmtpServer
+		return nil
+	}
+	smtpServer, smtpServerPort, _ := setupSmtpServer(smtpHandler)
+	defer teardownSmtpServer(smtpServer)
+	defer close(unlockSmtpServer)
+
+	session, err := dial(context.Background(), newPoolConfig(smtpServerPort))
+	require.Nil(t, err, "Failed to dial SMTP session: %s\n", err)
+	defer session.Close()
+
+	ctx, freeContext := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer freeContext()
+	err = session.Send(ctx, "source@test.com", []string{"target@test.com"}, []byte("Test"))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.True(t, session.Broken())
+}
+
+func TestSessionIsReusableAfterSuccess(t *testing.T) {
+	smtpServer, smtpServerPort, _ := setupSmtpServer(nil)
+	defer teardownSmtpServer(smtpServer)
+
+	session, err := dial(context.Background(), newPoolConfig(smtpServerPort))
+	require.Nil(t, err, "Failed to dial SMTP session: %s\n", err)
+	defer session.Close()
+
+	for range 2 {
+		ctx, freeContext := context.WithTimeout(context.Background(), time.Second)
+		err = session.Send(ctx, "source@test.com", []string{"target@test.com"}, []byte("Test"))
+		freeContext()
+		assert.Nil(t, err)
+		assert.False(t, session.Broken())
+	}
+}
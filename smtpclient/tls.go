@@ -0,0 +1,81 @@
+package smtpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+type TlsMode string
+
+const (
+	// The connection is encrypted from the start, usually on port 465.
+	TlsModeImplicit TlsMode = "implicit"
+	// The connection is upgraded with STARTTLS, which the server must support.
+	TlsModeStartTls TlsMode = "starttls"
+	// The connection is upgraded with STARTTLS if the server supports it, and stays in plaintext otherwise.
+	TlsModeOpportunistic TlsMode = "opportunistic"
+	// The connection stays in plaintext, which is only allowed towards the local host.
+	TlsModeNone TlsMode = "none"
+)
+
+func parseTlsMode(rawMode string, serverHost string) (TlsMode, error) {
+	switch mode := TlsMode(strings.ToLower(rawMode)); mode {
+	case "":
+		return TlsModeStartTls, nil
+	case TlsModeImplicit, TlsModeStartTls, TlsModeOpportunistic:
+		return mode, nil
+	case TlsModeNone:
+		if !isLocalHost(serverHost) {
+			return "", fmt.Errorf("TLS mode %q is only allowed for a local SMTP server, not %q", mode, serverHost)
+		}
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown TLS mode %q", rawMode)
+	}
+}
+
+func isLocalHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// loadTlsConfig trusts the system certificate authorities, along with the ones from caFile if any,
+// and presents the client certificate from certFile and keyFile if any.
+func loadTlsConfig(serverHost string, caFile string, certFile string, keyFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName: serverHost,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if caFile != "" {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			rootCAs = x509.NewCertPool()
+		}
+		caBundle, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		if !rootCAs.AppendCertsFromPEM(caBundle) {
+			return nil, fmt.Errorf("no certificate found in CA bundle %q", caFile)
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+
+	if certFile != "" || keyFile != "" {
+		clientCertificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{clientCertificate}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,183 @@
+package smtpclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/mhale/smtpd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCertificateFile = "../smtp_test_server.crt"
+const testKeyFile = "../smtp_test_server.key"
+
+func TestParseTlsMode(t *testing.T) {
+	for rawMode, expectedMode := range map[string]TlsMode{
+		"":              TlsModeStartTls,
+		"STARTTLS":      TlsModeStartTls,
+		"implicit":      TlsModeImplicit,
+		"opportunistic": TlsModeOpportunistic,
+	} {
+		mode, err := parseTlsMode(rawMode, "smtp.example.com")
+		assert.Nil(t, err)
+		assert.Equal(t, expectedMode, mode)
+	}
+
+	_, err := parseTlsMode("ssl", "smtp.example.com")
+	assert.NotNil(t, err)
+}
+
+func TestPlaintextOnlyAllowedForLocalHost(t *testing.T) {
+	for _, localHost := range []string{"localhost", "127.0.0.1", "::1"} {
+		mode, err := parseTlsMode("none", localHost)
+		assert.Nil(t, err)
+		assert.Equal(t, TlsModeNone, mode)
+	}
+
+	_, err := parseTlsMode("none", "smtp.example.com")
+	assert.NotNil(t, err)
+}
+
+func TestLoadTlsConfigFailsOnInvalidFiles(t *testing.T) {
+	_, err := loadTlsConfig("localhost", "missing.crt", "", "")
+	assert.NotNil(t, err)
+	_, err = loadTlsConfig("localhost", testKeyFile, "", "")
+	assert.NotNil(t, err)
+	_, err = loadTlsConfig("localhost", "", testCertificateFile, "")
+	assert.NotNil(t, err)
+}
+
+func TestStartTls(t *testing.T) {
+	smtpServer := newTlsTestSmtpServer()
+	smtpServer.TLSRequired = true
+	smtpServerPort := serveSmtp(smtpServer, false)
+	defer teardownSmtpServer(smtpServer)
+
+	assertDialSucceeds(t, newTlsTestConfig(smtpServerPort, TlsModeStartTls, newTestTlsConfig()))
+}
+
+func TestStartTlsRejectsUntrustedServer(t *testing.T) {
+	smtpServer := newTlsTestSmtpServer()
+	smtpServerPort := serveSmtp(smtpServer, false)
+	defer teardownSmtpServer(smtpServer)
+
+	config := newTlsTestConfig(smtpServerPort, TlsModeStartTls, &tls.Config{ServerName: "localhost"})
+	_, err := dial(context.Background(), config)
+	var verificationErr *tls.CertificateVerificationError
+	assert.ErrorAs(t, err, &verificationErr)
+}
+
+func TestStartTlsRequiresServerSupport(t *testing.T) {
+	smtpServer := newTlsTestSmtpServer()
+	smtpServer.TLSConfig = nil
+	smtpServerPort := serveSmtp(smtpServer, false)
+	defer teardownSmtpServer(smtpServer)
+
+	_, err := dial(context.Background(), newTlsTestConfig(smtpServerPort, TlsModeStartTls, newTestTlsConfig()))
+	assert.NotNil(t, err)
+}
+
+func TestImplicitTls(t *testing.T) {
+	smtpServer := newTlsTestSmtpServer()
+	smtpServer.TLSListener = true
+	smtpServerPort := serveSmtp(smtpServer, true)
+	defer teardownSmtpServer(smtpServer)
+
+	assertDialSucceeds(t, newTlsTestConfig(smtpServerPort, TlsModeImplicit, newTestTlsConfig()))
+}
+
+func TestOpportunisticTlsUpgradesWhenSupported(t *testing.T) {
+	smtpServer := newTlsTestSmtpServer()
+	smtpServer.TLSRequired = true
+	smtpServerPort := serveSmtp(smtpServer, false)
+	defer teardownSmtpServer(smtpServer)
+
+	assertDialSucceeds(t, newTlsTestConfig(smtpServerPort, TlsModeOpportunistic, newTestTlsConfig()))
+}
+
+func TestOpportunisticTlsFallsBackToPlaintext(t *testing.T) {
+	smtpServer := newTlsTestSmtpServer()
+	smtpServer.TLSConfig = nil
+	smtpServerPort := serveSmtp(smtpServer, false)
+	defer teardownSmtpServer(smtpServer)
+
+	assertDialSucceeds(t, newTlsTestConfig(smtpServerPort, TlsModeOpportunistic, newTestTlsConfig()))
+}
+
+func TestPlaintext(t *testing.T) {
+	smtpServer := newTlsTestSmtpServer()
+	smtpServer.TLSConfig = nil
+	smtpServerPort := serveSmtp(smtpServer, false)
+	defer teardownSmtpServer(smtpServer)
+
+	assertDialSucceeds(t, newTlsTestConfig(smtpServerPort, TlsModeNone, nil))
+}
+
+func TestClientCertificate(t *testing.T) {
+	smtpServer := newTlsTestSmtpServer()
+	smtpServer.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	smtpServer.TLSConfig.ClientCAs = newTestCertPool()
+	smtpServer.TLSListener = true
+	smtpServerPort := serveSmtp(smtpServer, true)
+	defer teardownSmtpServer(smtpServer)
+
+	tlsConfig, err := loadTlsConfig("localhost", testCertificateFile, testCertificateFile, testKeyFile)
+	require.Nil(t, err, "Failed to load TLS configuration: %s\n", err)
+	assertDialSucceeds(t, newTlsTestConfig(smtpServerPort, TlsModeImplicit, tlsConfig))
+
+	_, err = dial(context.Background(), newTlsTestConfig(smtpServerPort, TlsModeImplicit, newTestTlsConfig()))
+	assert.NotNil(t, err)
+}
+
+func assertDialSucceeds(t *testing.T, config *Config) {
+	session, err := dial(context.Background(), config)
+	require.Nil(t, err, "Failed to dial SMTP session: %s\n", err)
+	err = session.Send(context.Background(), "source@test.com", []string{"target@test.com"}, []byte("Test"))
+	assert.Nil(t, err)
+	session.Close()
+}
+
+func newTlsTestSmtpServer() *smtpd.Server {
+	smtpServer := &smtpd.Server{
+		AuthHandler: func(_ net.Addr, _ string, _ []byte, _ []byte, _ []byte) (bool, error) {
+			return true, nil
+		},
+		AuthMechs: map[string]bool{"PLAIN": true},
+	}
+	configureTls(smtpServer)
+	return smtpServer
+}
+
+func newTlsTestConfig(smtpServerPort int, tlsMode TlsMode, tlsConfig *tls.Config) *Config {
+	return &Config{
+		ServerHost:   "localhost",
+		ServerPort:   strconv.Itoa(smtpServerPort),
+		TlsMode:      tlsMode,
+		TlsConfig:    tlsConfig,
+		DialAttempts: 1,
+	}
+}
+
+func newTestTlsConfig() *tls.Config {
+	return &tls.Config{
+		ServerName: "localhost",
+		RootCAs:    newTestCertPool(),
+	}
+}
+
+func newTestCertPool() *x509.CertPool {
+	certificate, err := os.ReadFile(testCertificateFile)
+	if err != nil {
+		log.Panicf("Failed to read test certificate: %s\n", err)
+	}
+	certPool := x509.NewCertPool()
+	certPool.AppendCertsFromPEM(certificate)
+	return certPool
+}
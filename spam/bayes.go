@@ -0,0 +1,122 @@
+package spam
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Bayes is a naive Bayes classifier, trained from a corpus of labelled messages.
+type Bayes struct {
+	score float64
+	// Number of occurrences of each word, per label.
+	wordCounts map[string]map[string]int
+	// Number of words, per label.
+	totalWords map[string]int
+	// Number of messages, per label.
+	messages   map[string]int
+	vocabulary map[string]struct{}
+}
+
+const (
+	spamLabel = "spam"
+	hamLabel  = "ham"
+)
+
+func NewBayes(score float64) *Bayes {
+	return &Bayes{
+		score:      score,
+		wordCounts: map[string]map[string]int{spamLabel: {}, hamLabel: {}},
+		totalWords: map[string]int{},
+		messages:   map[string]int{},
+		vocabulary: map[string]struct{}{},
+	}
+}
+
+// LoadBayes trains a classifier from a corpus file, in which each line holds a label, `spam` or `ham`,
+// then a tab and the text of a message. Blank lines and lines starting with # are ignored.
+func LoadBayes(path string, score float64) (*Bayes, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spam corpus: %w", err)
+	}
+	defer file.Close()
+
+	classifier := NewBayes(score)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		label, text, found := strings.Cut(line, "\t")
+		if !found || (label != spamLabel && label != hamLabel) {
+			return nil, fmt.Errorf("invalid spam corpus line %d: must start with %q or %q followed by a tab", lineNumber, spamLabel, hamLabel)
+		}
+		classifier.Train(label == spamLabel, text)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read spam corpus: %w", err)
+	}
+	return classifier, nil
+}
+
+func (classifier *Bayes) Train(isSpam bool, text string) {
+	label := hamLabel
+	if isSpam {
+		label = spamLabel
+	}
+	classifier.messages[label]++
+	for _, word := range tokenize(text) {
+		classifier.wordCounts[label][word]++
+		classifier.totalWords[label]++
+		classifier.vocabulary[word] = struct{}{}
+	}
+}
+
+// SpamProbability returns the probability that the text is spam, or 0.5 until both labels were trained.
+func (classifier *Bayes) SpamProbability(text string) float64 {
+	if classifier.messages[spamLabel] == 0 || classifier.messages[hamLabel] == 0 {
+		return 0.5
+	}
+	words := tokenize(text)
+	spamLikelihood := classifier.logLikelihood(spamLabel, words)
+	hamLikelihood := classifier.logLikelihood(hamLabel, words)
+	return 1 / (1 + math.Exp(hamLikelihood-spamLikelihood))
+}
+
+// logLikelihood is the log of the prior of the label, and of the probabilities of the words within the label,
+// with Laplace smoothing so that unknown words do not rule the label out.
+func (classifier *Bayes) logLikelihood(label string, words []string) float64 {
+	allMessages := classifier.messages[spamLabel] + classifier.messages[hamLabel]
+	likelihood := math.Log(float64(classifier.messages[label]) / float64(allMessages))
+	denominator := float64(classifier.totalWords[label] + len(classifier.vocabulary))
+	for _, word := range words {
+		likelihood += math.Log(float64(classifier.wordCounts[label][word]+1) / denominator)
+	}
+	return likelihood
+}
+
+func (classifier *Bayes) Name() string { return "bayes" }
+
+// Score only counts the probabilities leaning towards spam, scaled from 0 at even odds to the full score at certainty.
+func (classifier *Bayes) Score(submission *Submission) float64 {
+	probability := classifier.SpamProbability(submission.text())
+	return classifier.score * max(2*probability-1, 0)
+}
+
+func tokenize(text string) []string {
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(char rune) bool {
+		return !unicode.IsLetter(char) && !unicode.IsDigit(char)
+	}) {
+		if len([]rune(word)) >= 2 {
+			words = append(words, word)
+		}
+	}
+	return words
+}
@@ -0,0 +1,58 @@
+package spam
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCorpus = `# Labelled contact messages
+spam	Buy cheap pills online, best prices guaranteed
+spam	Increase your website traffic with our SEO services
+spam	Cheap SEO backlinks, best prices, order online now
+
+ham	Hi, I loved your portfolio and would like to discuss a project
+ham	Hello, are you available for a freelance mission next month?
+ham	Thanks for your talk, could you share the slides?
+`
+
+func TestBayes(t *testing.T) {
+	classifier := loadTestBayes(t, testCorpus)
+
+	spamProbability := classifier.SpamProbability("Best SEO prices, buy backlinks online")
+	hamProbability := classifier.SpamProbability("Hi, would you be available to discuss a project?")
+	assert.Greater(t, spamProbability, 0.9)
+	assert.Less(t, hamProbability, 0.1)
+
+	assert.InDelta(t, 5*(2*spamProbability-1), classifier.Score(&Submission{Body: "Best SEO prices, buy backlinks online"}), 1e-9)
+	assert.Zero(t, classifier.Score(&Submission{Body: "Hi, would you be available to discuss a project?"}))
+}
+
+func TestUntrainedBayes(t *testing.T) {
+	classifier := loadTestBayes(t, "spam\tCheap pills\n")
+	assert.Equal(t, 0.5, classifier.SpamProbability("Cheap pills"))
+	assert.Zero(t, classifier.Score(&Submission{Body: "Cheap pills"}))
+}
+
+func TestRejectInvalidCorpus(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corpus.tsv")
+	require.Nil(t, os.WriteFile(path, []byte("spam\tCheap pills\nmaybe\tHello\n"), 0o640))
+
+	_, err := LoadBayes(path, 5)
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"hello", "world", "c3po", "été"}, tokenize("Hello, WORLD! a c3po Été"))
+}
+
+func loadTestBayes(t *testing.T, corpus string) *Bayes {
+	path := filepath.Join(t.TempDir(), "corpus.tsv")
+	require.Nil(t, os.WriteFile(path, []byte(corpus), 0o640))
+	classifier, err := LoadBayes(path, 5)
+	require.Nil(t, err)
+	return classifier
+}
@@ -0,0 +1,154 @@
+package spam
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"portfolio-back/store"
+)
+
+var (
+	linkPattern   = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"]+`)
+	markupPattern = regexp.MustCompile(`(?i)<\s*/?\s*(?:script|a|iframe|img|html|body|style)\b|\[/?(?:url|link)\b`)
+)
+
+// linksRule scores each link beyond the ones a genuine message may contain.
+type linksRule struct {
+	score    float64
+	maxLinks int
+}
+
+func (rule *linksRule) Name() string { return "links" }
+
+func (rule *linksRule) Score(submission *Submission) float64 {
+	extraLinks := len(linkPattern.FindAllString(submission.text(), -1)) - rule.maxLinks
+	return rule.score * float64(max(extraLinks, 0))
+}
+
+// keywordsRule scores each blocklisted keyword found, regardless of case.
+type keywordsRule struct {
+	score    float64
+	keywords []string
+}
+
+func newKeywordsRule(score float64, keywords []string) *keywordsRule {
+	rule := &keywordsRule{score: score}
+	for _, keyword := range keywords {
+		rule.keywords = append(rule.keywords, strings.ToLower(keyword))
+	}
+	return rule
+}
+
+func (rule *keywordsRule) Name() string { return "keywords" }
+
+func (rule *keywordsRule) Score(submission *Submission) float64 {
+	text := strings.ToLower(submission.text())
+	matches := 0
+	for _, keyword := range rule.keywords {
+		if strings.Contains(text, keyword) {
+			matches++
+		}
+	}
+	return rule.score * float64(matches)
+}
+
+// markupRule scores HTML and BBCode, which visitors have no reason to type in a plain text form.
+type markupRule struct {
+	score float64
+}
+
+func (rule *markupRule) Name() string { return "markup" }
+
+func (rule *markupRule) Score(submission *Submission) float64 {
+	if markupPattern.MatchString(submission.text()) {
+		return rule.score
+	}
+	return 0
+}
+
+// charsetRule scores invisible formatting characters and words mixing Latin with look-alike scripts,
+// which are used to evade keyword filters.
+type charsetRule struct {
+	score float64
+}
+
+func (rule *charsetRule) Name() string { return "charset" }
+
+func (rule *charsetRule) Score(submission *Submission) float64 {
+	for _, field := range []string{submission.Sender, submission.Subject, submission.Body} {
+		if strings.IndexFunc(field, isInvisible) >= 0 {
+			return rule.score
+		}
+		for _, word := range strings.FieldsFunc(field, func(char rune) bool { return !unicode.IsLetter(char) }) {
+			if mixesScripts(word) {
+				return rule.score
+			}
+		}
+	}
+	return 0
+}
+
+// isInvisible matches format characters, such as zero-width spaces and bidirectional overrides.
+func isInvisible(char rune) bool {
+	return unicode.Is(unicode.Cf, char)
+}
+
+func mixesScripts(word string) bool {
+	var hasLatin, hasLookAlike bool
+	for _, char := range word {
+		switch {
+		case unicode.Is(unicode.Latin, char):
+			hasLatin = true
+		case unicode.Is(unicode.Cyrillic, char), unicode.Is(unicode.Greek, char):
+			hasLookAlike = true
+		}
+	}
+	return hasLatin && hasLookAlike
+}
+
+// duplicateRule scores bodies which were already delivered within the window,
+// regardless of case and whitespace.
+type duplicateRule struct {
+	score  float64
+	window time.Duration
+	store  store.Store
+}
+
+func (rule *duplicateRule) Name() string { return "duplicate" }
+
+func (rule *duplicateRule) Score(submission *Submission) float64 {
+	seen := false
+	err := rule.store.Update(duplicateKey(submission), func(entry *store.Entry) *store.Entry {
+		seen = entry != nil
+		return entry
+	})
+	if err != nil {
+		log.Printf("[ERROR] Failed to check for duplicate submissions: %s\n", err)
+		return 0
+	}
+	if seen {
+		return rule.score
+	}
+	return 0
+}
+
+// Remember records the body once delivered, so that a submission retried after a failed delivery is not a duplicate.
+func (rule *duplicateRule) Remember(submission *Submission) {
+	err := rule.store.Update(duplicateKey(submission), func(*store.Entry) *store.Entry {
+		return &store.Entry{ExpiresAt: time.Now().Add(rule.window)}
+	})
+	if err != nil {
+		log.Printf("[ERROR] Failed to remember submission for duplicate detection: %s\n", err)
+	}
+}
+
+func duplicateKey(submission *Submission) string {
+	normalizedBody := strings.Join(strings.Fields(strings.ToLower(submission.Body)), " ")
+	hash := sha256.Sum256([]byte(normalizedBody))
+	return "body:" + hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,68 @@
+package spam
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"portfolio-back/store"
+)
+
+func TestLinksRule(t *testing.T) {
+	rule := &linksRule{score: 1.5, maxLinks: 1}
+	assert.Zero(t, rule.Score(&Submission{Body: "See https://example.com"}))
+	assert.Equal(t, 3.0, rule.Score(&Submission{
+		Subject: "www.spam.test",
+		Body:    "http://a.test/1 and HTTPS://b.test/2",
+	}))
+}
+
+func TestKeywordsRule(t *testing.T) {
+	rule := newKeywordsRule(2, []string{"Casino", "free money"})
+	assert.Zero(t, rule.Score(&Submission{Body: "Hello there"}))
+	assert.Equal(t, 2.0, rule.Score(&Submission{Subject: "CASINO night", Body: "casino casino"}))
+	assert.Equal(t, 4.0, rule.Score(&Submission{Subject: "Casino", Body: "Get FREE MONEY"}))
+}
+
+func TestMarkupRule(t *testing.T) {
+	rule := &markupRule{score: 2}
+	for _, body := range []string{"<script>alert(1)</script>", `<a href="http://spam.test">`, "[url=http://spam.test]pills[/url]", "< IMG src=x>"} {
+		assert.Equal(t, 2.0, rule.Score(&Submission{Body: body}), "Markup not detected in %q", body)
+	}
+	for _, body := range []string{"I <3 your work", "a < b and c > d", "[1] footnote", "<abbr>"} {
+		assert.Zero(t, rule.Score(&Submission{Body: body}), "Markup wrongly detected in %q", body)
+	}
+}
+
+func TestCharsetRule(t *testing.T) {
+	rule := &charsetRule{score: 2}
+	for _, submission := range []*Submission{
+		{Body: "Free\u200bmoney"},
+		{Body: "Invoice \u202egpj.exe"},
+		{Subject: "Vi\u0430gra"},
+		{Sender: "P\u0430yPal"},
+	} {
+		assert.Equal(t, 2.0, rule.Score(submission), "Anomaly not detected in %+v", submission)
+	}
+	for _, submission := range []*Submission{
+		{Subject: "Réponse à ta question ✨", Body: "Merci beaucoup, Zoë"},
+		{Body: "Привет, how are you? Γειά σου"},
+		{Body: "日本語のテキスト"},
+	} {
+		assert.Zero(t, rule.Score(submission), "Anomaly wrongly detected in %+v", submission)
+	}
+}
+
+func TestDuplicateRule(t *testing.T) {
+	rule := &duplicateRule{score: 3, window: time.Hour, store: store.NewMemory()}
+	assert.Zero(t, rule.Score(&Submission{Body: "Hello there"}))
+	assert.Zero(t, rule.Score(&Submission{Body: "Hello there"}), "Scoring must not remember the body")
+	rule.Remember(&Submission{Body: "Hello there"})
+	assert.Equal(t, 3.0, rule.Score(&Submission{Body: "  HELLO\n there "}))
+	assert.Zero(t, rule.Score(&Submission{Body: "Something else"}))
+
+	expiringRule := &duplicateRule{score: 3, window: -time.Second, store: store.NewMemory()}
+	expiringRule.Remember(&Submission{Body: "Hello there"})
+	assert.Zero(t, expiringRule.Score(&Submission{Body: "Hello there"}))
+}
@@ -0,0 +1,150 @@
+package spam
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"portfolio-back/config"
+	"portfolio-back/store"
+)
+
+// Submission is what contact messages are scored on.
+type Submission struct {
+	Sender      string
+	SenderEmail string
+	Subject     string
+	Body        string
+}
+
+// text concatenates the free-form fields, which most rules inspect as a whole.
+func (submission *Submission) text() string {
+	return submission.Subject + "\n" + submission.Body
+}
+
+// Rule scores how much a submission looks like spam, 0 meaning not at all.
+type Rule interface {
+	Name() string
+	Score(submission *Submission) float64
+}
+
+// Remembering rules learn from the submissions which were delivered.
+type Remembering interface {
+	Remember(submission *Submission)
+}
+
+type Verdict int
+
+const (
+	Accept Verdict = iota
+	// Tag forwards the email with its subject marked as spam.
+	Tag
+	// Quarantine keeps the email aside instead of forwarding it.
+	Quarantine
+	Reject
+)
+
+func (verdict Verdict) String() string {
+	return [...]string{"accept", "tag", "quarantine", "reject"}[verdict]
+}
+
+// Match is a rule which scored a submission.
+type Match struct {
+	Rule  string
+	Score float64
+}
+
+type Result struct {
+	Score   float64
+	Verdict Verdict
+	Matches []Match
+}
+
+func (result *Result) String() string {
+	matches := make([]string, len(result.Matches))
+	for i, match := range result.Matches {
+		matches[i] = fmt.Sprintf("%s=%g", match.Rule, match.Score)
+	}
+	return fmt.Sprintf("%s with score %g (%s)", result.Verdict, result.Score, strings.Join(matches, ", "))
+}
+
+// Pipeline sums the scores of its rules, and compares the total with the thresholds of each verdict.
+// A threshold of 0 disables its verdict.
+type Pipeline struct {
+	rules               []Rule
+	tagThreshold        float64
+	quarantineThreshold float64
+	rejectThreshold     float64
+}
+
+func NewPipeline(rules []Rule, getEnv func(string) string) *Pipeline {
+	return &Pipeline{
+		rules:               rules,
+		tagThreshold:        config.Float(getEnv, "SPAM_TAG_THRESHOLD", 5),
+		quarantineThreshold: config.Float(getEnv, "SPAM_QUARANTINE_THRESHOLD", 8),
+		rejectThreshold:     config.Float(getEnv, "SPAM_REJECT_THRESHOLD", 12),
+	}
+}
+
+// New builds a pipeline with the built-in rules, each scoring SPAM_<RULE>_SCORE when it fires.
+// The naive Bayes classifier is only enabled if SPAM_CORPUS_FILE is set.
+func New(getEnv func(string) string) (*Pipeline, error) {
+	duplicateStore, err := store.New(getEnv, "SPAM")
+	if err != nil {
+		return nil, err
+	}
+	rules := []Rule{
+		&linksRule{
+			score:    config.Float(getEnv, "SPAM_LINKS_SCORE", 1),
+			maxLinks: config.Int(getEnv, "SPAM_MAX_LINKS", 2),
+		},
+		newKeywordsRule(config.Float(getEnv, "SPAM_KEYWORDS_SCORE", 2), config.List(getEnv, "SPAM_KEYWORDS")),
+		&markupRule{score: config.Float(getEnv, "SPAM_MARKUP_SCORE", 2)},
+		&charsetRule{score: config.Float(getEnv, "SPAM_CHARSET_SCORE", 2)},
+		&duplicateRule{
+			score:  config.Float(getEnv, "SPAM_DUPLICATE_SCORE", 3),
+			window: config.Milliseconds(getEnv, "SPAM_DUPLICATE_WINDOW", 24*time.Hour),
+			store:  duplicateStore,
+		},
+	}
+	if corpusPath := getEnv("SPAM_CORPUS_FILE"); corpusPath != "" {
+		classifier, err := LoadBayes(corpusPath, config.Float(getEnv, "SPAM_BAYES_SCORE", 5))
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, classifier)
+	}
+	return NewPipeline(rules, getEnv), nil
+}
+
+func (pipeline *Pipeline) Evaluate(submission *Submission) *Result {
+	result := &Result{}
+	for _, rule := range pipeline.rules {
+		if score := rule.Score(submission); score != 0 {
+			result.Score += score
+			result.Matches = append(result.Matches, Match{Rule: rule.Name(), Score: score})
+		}
+	}
+	switch {
+	case exceeds(result.Score, pipeline.rejectThreshold):
+		result.Verdict = Reject
+	case exceeds(result.Score, pipeline.quarantineThreshold):
+		result.Verdict = Quarantine
+	case exceeds(result.Score, pipeline.tagThreshold):
+		result.Verdict = Tag
+	}
+	return result
+}
+
+// Remember tells the rules that the submission was delivered.
+func (pipeline *Pipeline) Remember(submission *Submission) {
+	for _, rule := range pipeline.rules {
+		if remembering, ok := rule.(Remembering); ok {
+			remembering.Remember(submission)
+		}
+	}
+}
+
+func exceeds(score float64, threshold float64) bool {
+	return threshold > 0 && score >= threshold
+}
@@ -0,0 +1,92 @@
+package spam
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fixedRule scores every submission the same.
+type fixedRule struct {
+	name  string
+	score float64
+}
+
+func (rule *fixedRule) Name() string { return rule.name }
+
+func (rule *fixedRule) Score(*Submission) float64 { return rule.score }
+
+func TestVerdicts(t *testing.T) {
+	getEnv := mockGetEnv(map[string]string{
+		"SPAM_TAG_THRESHOLD":        "2",
+		"SPAM_QUARANTINE_THRESHOLD": "4",
+		"SPAM_REJECT_THRESHOLD":     "6",
+	})
+	for score, expectedVerdict := range map[float64]Verdict{
+		0:   Accept,
+		1.5: Accept,
+		2:   Tag,
+		4.5: Quarantine,
+		6:   Reject,
+	} {
+		pipeline := NewPipeline([]Rule{&fixedRule{"first", score / 2}, &fixedRule{"second", score / 2}}, getEnv)
+		result := pipeline.Evaluate(&Submission{})
+		assert.Equal(t, score, result.Score)
+		assert.Equal(t, expectedVerdict, result.Verdict, "Unexpected verdict for score %g", score)
+	}
+}
+
+func TestDisabledThresholds(t *testing.T) {
+	getEnv := mockGetEnv(map[string]string{
+		"SPAM_TAG_THRESHOLD":        "2",
+		"SPAM_QUARANTINE_THRESHOLD": "0",
+		"SPAM_REJECT_THRESHOLD":     "0",
+	})
+	pipeline := NewPipeline([]Rule{&fixedRule{"huge", 100}}, getEnv)
+	assert.Equal(t, Tag, pipeline.Evaluate(&Submission{}).Verdict)
+}
+
+func TestResultListsMatches(t *testing.T) {
+	pipeline := NewPipeline([]Rule{&fixedRule{"links", 2}, &fixedRule{"silent", 0}, &fixedRule{"markup", 3}}, mockGetEnv(nil))
+	result := pipeline.Evaluate(&Submission{})
+
+	assert.Equal(t, []Match{{Rule: "links", Score: 2}, {Rule: "markup", Score: 3}}, result.Matches)
+	assert.Equal(t, "tag with score 5 (links=2, markup=3)", result.String())
+}
+
+func TestNew(t *testing.T) {
+	corpusPath := filepath.Join(t.TempDir(), "corpus.tsv")
+	require.Nil(t, os.WriteFile(corpusPath, []byte("spam\tcheap pills\nham\thello there\n"), 0o640))
+	env := map[string]string{"SPAM_CORPUS_FILE": corpusPath, "SPAM_KEYWORDS": "casino"}
+
+	pipeline, err := New(mockGetEnv(env))
+	require.Nil(t, err)
+	assert.Len(t, pipeline.rules, 6)
+	result := pipeline.Evaluate(&Submission{Subject: "Casino", Body: "Cheap pills"})
+	assert.Equal(t, "keywords", result.Matches[0].Rule)
+	assert.Equal(t, "bayes", result.Matches[1].Rule)
+
+	env["SPAM_CORPUS_FILE"] = filepath.Join(t.TempDir(), "missing.tsv")
+	_, err = New(mockGetEnv(env))
+	assert.NotNil(t, err)
+}
+
+func TestRememberDeliveredSubmissions(t *testing.T) {
+	pipeline, err := New(mockGetEnv(nil))
+	require.Nil(t, err)
+	submission := &Submission{Body: "Hello there"}
+	assert.Empty(t, pipeline.Evaluate(submission).Matches)
+	assert.Empty(t, pipeline.Evaluate(submission).Matches)
+
+	pipeline.Remember(submission)
+	assert.Equal(t, []Match{{Rule: "duplicate", Score: 3}}, pipeline.Evaluate(submission).Matches)
+}
+
+func mockGetEnv(env map[string]string) func(string) string {
+	return func(key string) string {
+		return env[key]
+	}
+}
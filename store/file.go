@@ -0,0 +1,114 @@
+package store
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const lockFileName = ".lock"
+
+// File persists entries as JSON files, so that they are shared by the processes using the same directory,
+// such as Lambda instances mounting the same EFS volume.
+type File struct {
+	directory string
+	lockPath  string
+	// Serializes the updates within the process, on top of the lock shared across processes.
+	mutex sync.Mutex
+}
+
+func NewFile(directory string) (*File, error) {
+	err := os.MkdirAll(directory, 0o750)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+	store := &File{directory: directory, lockPath: filepath.Join(directory, lockFileName)}
+	store.sweep()
+	return store, nil
+}
+
+func (store *File) Update(key string, update func(entry *Entry) *Entry) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	unlock, err := lockFile(store.lockPath)
+	if err != nil {
+		return fmt.Errorf("failed to lock store: %w", err)
+	}
+	defer unlock()
+
+	path := store.entryPath(key)
+	current, err := readEntry(path)
+	if err != nil {
+		log.Printf("[ERROR] Discarding unreadable store entry %s: %s\n", path, err)
+	}
+	if current != nil && current.expired(time.Now()) {
+		current = nil
+	}
+
+	next := update(current)
+	if next == nil {
+		err = os.Remove(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return writeEntry(path, next)
+}
+
+// entryPath hashes the key, which may contain characters that are invalid in file names.
+func (store *File) entryPath(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return filepath.Join(store.directory, hex.EncodeToString(hash[:])+".json")
+}
+
+// sweep deletes the expired entries, which are otherwise only overwritten when their key is reused.
+func (store *File) sweep() {
+	paths, err := filepath.Glob(filepath.Join(store.directory, "*.json"))
+	if err != nil {
+		return
+	}
+	now := time.Now()
+	for _, path := range paths {
+		entry, err := readEntry(path)
+		if err != nil || (entry != nil && entry.expired(now)) {
+			os.Remove(path)
+		}
+	}
+}
+
+func readEntry(path string) (*Entry, error) {
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entry *Entry
+	err = json.Unmarshal(content, &entry)
+	return entry, err
+}
+
+// writeEntry writes to a temporary file first, so that entries are never read partially written.
+func writeEntry(path string, entry *Entry) error {
+	content, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	temporaryPath := strings.TrimSuffix(path, ".json") + ".tmp"
+	err = os.WriteFile(temporaryPath, content, 0o640)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temporaryPath, path)
+}
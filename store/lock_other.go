@@ -0,0 +1,9 @@
+//go:build !unix
+
+package store
+
+// lockFile is a no-op where advisory locks are not supported,
+// so that updates are only serialized within the current process.
+func lockFile(string) (unlock func(), err error) {
+	return func() {}, nil
+}
@@ -0,0 +1,46 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+// sweepInterval is the number of updates between two sweeps of the expired entries.
+const sweepInterval = 1000
+
+// Memory keeps entries in the memory of the current process.
+type Memory struct {
+	mutex   sync.Mutex
+	entries map[string]*Entry
+	updates int
+}
+
+func NewMemory() *Memory {
+	return &Memory{entries: map[string]*Entry{}}
+}
+
+func (store *Memory) Update(key string, update func(entry *Entry) *Entry) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	now := time.Now()
+	store.updates++
+	if store.updates%sweepInterval == 0 {
+		for sweptKey, entry := range store.entries {
+			if entry.expired(now) {
+				delete(store.entries, sweptKey)
+			}
+		}
+	}
+
+	current := store.entries[key]
+	if current != nil && current.expired(now) {
+		current = nil
+	}
+	if next := update(current); next != nil {
+		store.entries[key] = next
+	} else {
+		delete(store.entries, key)
+	}
+	return nil
+}
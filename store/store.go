@@ -0,0 +1,50 @@
+package store
+
+import (
+	"fmt"
+	"time"
+)
+
+// Entry is a value kept until it expires.
+type Entry struct {
+	Value     []byte
+	ExpiresAt time.Time
+}
+
+func (entry *Entry) expired(now time.Time) bool {
+	return !entry.ExpiresAt.IsZero() && !now.Before(entry.ExpiresAt)
+}
+
+// Store keeps short-lived state, such as rate limits, possibly across processes.
+type Store interface {
+	// Update atomically replaces the entry of key with the result of update,
+	// which receives nil if the key is missing or expired, and returns nil to delete the entry.
+	Update(key string, update func(entry *Entry) *Entry) error
+}
+
+// New builds the store selected by <prefix>_STORE, such as RATE_LIMIT_STORE.
+// The file store persists entries into <prefix>_STORE_DIRECTORY.
+func New(getEnv func(string) string, prefix string) (Store, error) {
+	switch name := getEnv(prefix + "_STORE"); name {
+	case "", "memory":
+		return NewMemory(), nil
+	case "file":
+		directory := getEnv(prefix + "_STORE_DIRECTORY")
+		if directory == "" {
+			return nil, fmt.Errorf("%s_STORE_DIRECTORY is required by the file store", prefix)
+		}
+		return NewFile(directory)
+	default:
+		return nil, fmt.Errorf("unknown %s store %q", prefix, name)
+	}
+}
+
+// Get returns the entry of key, or nil if it is missing or expired.
+func Get(store Store, key string) (*Entry, error) {
+	var current *Entry
+	err := store.Update(key, func(entry *Entry) *Entry {
+		current = entry
+		return entry
+	})
+	return current, err
+}
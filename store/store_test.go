@@ -0,0 +1,144 @@
+package store
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStores(t *testing.T) {
+	newStores := map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store { return NewMemory() },
+		"file": func(t *testing.T) Store {
+			store, err := NewFile(t.TempDir())
+			require.Nil(t, err)
+			return store
+		},
+	}
+	for name, newStore := range newStores {
+		t.Run(name, func(t *testing.T) {
+			t.Run("UpdateAndGet", func(t *testing.T) { testUpdateAndGet(t, newStore(t)) })
+			t.Run("Delete", func(t *testing.T) { testDelete(t, newStore(t)) })
+			t.Run("Expire", func(t *testing.T) { testExpire(t, newStore(t)) })
+			t.Run("ConcurrentUpdates", func(t *testing.T) { testConcurrentUpdates(t, newStore(t)) })
+		})
+	}
+}
+
+func testUpdateAndGet(t *testing.T, store Store) {
+	entry, err := Get(store, "key")
+	require.Nil(t, err)
+	assert.Nil(t, entry)
+
+	err = store.Update("key", func(entry *Entry) *Entry {
+		return &Entry{Value: []byte("value")}
+	})
+	require.Nil(t, err)
+
+	entry, err = Get(store, "key")
+	require.Nil(t, err)
+	require.NotNil(t, entry)
+	assert.Equal(t, "value", string(entry.Value))
+}
+
+func testDelete(t *testing.T, store Store) {
+	require.Nil(t, store.Update("key", func(*Entry) *Entry { return &Entry{Value: []byte("value")} }))
+	require.Nil(t, store.Update("key", func(*Entry) *Entry { return nil }))
+	require.Nil(t, store.Update("missing", func(*Entry) *Entry { return nil }))
+
+	entry, err := Get(store, "key")
+	require.Nil(t, err)
+	assert.Nil(t, entry)
+}
+
+func testExpire(t *testing.T, store Store) {
+	expiresAt := time.Now().Add(-time.Second)
+	require.Nil(t, store.Update("key", func(*Entry) *Entry { return &Entry{Value: []byte("value"), ExpiresAt: expiresAt} }))
+
+	entry, err := Get(store, "key")
+	require.Nil(t, err)
+	assert.Nil(t, entry)
+}
+
+func testConcurrentUpdates(t *testing.T, store Store) {
+	var waitGroup sync.WaitGroup
+	for range 20 {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+			err := store.Update("counter", func(entry *Entry) *Entry {
+				count := 0
+				if entry != nil {
+					fmt.Sscan(string(entry.Value), &count)
+				}
+				return &Entry{Value: []byte(fmt.Sprint(count + 1))}
+			})
+			assert.Nil(t, err)
+		}()
+	}
+	waitGroup.Wait()
+
+	entry, err := Get(store, "counter")
+	require.Nil(t, err)
+	assert.Equal(t, "20", string(entry.Value))
+}
+
+func TestFileStoreIsSharedAcrossInstances(t *testing.T) {
+	directory := t.TempDir()
+	first, err := NewFile(directory)
+	require.Nil(t, err)
+	second, err := NewFile(directory)
+	require.Nil(t, err)
+
+	require.Nil(t, first.Update("key", func(*Entry) *Entry { return &Entry{Value: []byte("value")} }))
+
+	entry, err := Get(second, "key")
+	require.Nil(t, err)
+	require.NotNil(t, entry)
+	assert.Equal(t, "value", string(entry.Value))
+}
+
+func TestFileStoreSweepsExpiredEntries(t *testing.T) {
+	directory := t.TempDir()
+	store, err := NewFile(directory)
+	require.Nil(t, err)
+	expiresAt := time.Now().Add(-time.Second)
+	require.Nil(t, store.Update("expired", func(*Entry) *Entry { return &Entry{ExpiresAt: expiresAt} }))
+	require.Nil(t, store.Update("kept", func(*Entry) *Entry { return &Entry{} }))
+	require.Nil(t, os.WriteFile(filepath.Join(directory, "corrupted.json"), []byte("{"), 0o640))
+
+	_, err = NewFile(directory)
+	require.Nil(t, err)
+
+	paths, err := filepath.Glob(filepath.Join(directory, "*.json"))
+	require.Nil(t, err)
+	assert.Equal(t, []string{store.entryPath("kept")}, paths)
+}
+
+func TestNew(t *testing.T) {
+	env := map[string]string{}
+	getEnv := func(key string) string { return env[key] }
+
+	store, err := New(getEnv, "TEST")
+	require.Nil(t, err)
+	assert.IsType(t, &Memory{}, store)
+
+	env["TEST_STORE"] = "file"
+	_, err = New(getEnv, "TEST")
+	assert.NotNil(t, err)
+
+	env["TEST_STORE_DIRECTORY"] = t.TempDir()
+	store, err = New(getEnv, "TEST")
+	require.Nil(t, err)
+	assert.IsType(t, &File{}, store)
+
+	env["TEST_STORE"] = "redis"
+	_, err = New(getEnv, "TEST")
+	assert.NotNil(t, err)
+}
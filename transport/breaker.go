@@ -0,0 +1,108 @@
+package transport
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (state breakerState) String() string {
+	switch state {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// breaker stops using a relay after consecutive failures.
+// Once open for long enough, a single probe is let through, which closes the breaker if it succeeds.
+type breaker struct {
+	name         string
+	threshold    int
+	openDuration time.Duration
+
+	mutex    sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreaker(name string, threshold int, openDuration time.Duration) *breaker {
+	return &breaker{name: name, threshold: threshold, openDuration: openDuration}
+}
+
+// Allow reports whether the relay may be used. In the half-open state, only the probe is allowed.
+func (breaker *breaker) Allow() bool {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	switch breaker.state {
+	case breakerOpen:
+		if time.Since(breaker.openedAt) < breaker.openDuration {
+			return false
+		}
+		breaker.transition(breakerHalfOpen)
+		breaker.probing = true
+		return true
+	case breakerHalfOpen:
+		if breaker.probing {
+			return false
+		}
+		breaker.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Record reports the outcome of an allowed attempt.
+func (breaker *breaker) Record(success bool) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	breaker.probing = false
+	if success {
+		breaker.failures = 0
+		if breaker.state != breakerClosed {
+			breaker.transition(breakerClosed)
+		}
+		return
+	}
+	breaker.failures++
+	if breaker.state == breakerHalfOpen || breaker.failures >= breaker.threshold {
+		breaker.openedAt = time.Now()
+		breaker.transition(breakerOpen)
+	}
+}
+
+// Abandon reports an allowed attempt which was interrupted before reaching an outcome.
+func (breaker *breaker) Abandon() {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	breaker.probing = false
+}
+
+func (breaker *breaker) State() breakerState {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	return breaker.state
+}
+
+func (breaker *breaker) transition(state breakerState) {
+	level := "[INFO]"
+	if state == breakerOpen {
+		level = "[WARN]"
+	}
+	log.Printf("%s Circuit breaker of SMTP relay %s is now %s (was %s)\n", level, breaker.name, state, breaker.state)
+	breaker.state = state
+}
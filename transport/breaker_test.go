@@ -0,0 +1,61 @@
+package transport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	breaker := newBreaker("primary", 2, time.Minute)
+	assert.True(t, breaker.Allow())
+	breaker.Record(false)
+	assert.True(t, breaker.Allow())
+	breaker.Record(true)
+	assert.True(t, breaker.Allow())
+	breaker.Record(false)
+	assert.Equal(t, breakerClosed, breaker.State())
+
+	assert.True(t, breaker.Allow())
+	breaker.Record(false)
+	assert.Equal(t, breakerOpen, breaker.State())
+	assert.False(t, breaker.Allow())
+}
+
+func TestBreakerLetsSingleProbeThroughOnceHalfOpen(t *testing.T) {
+	breaker := newBreaker("primary", 1, 10*time.Millisecond)
+	breaker.Allow()
+	breaker.Record(false)
+	time.Sleep(20 * time.Millisecond)
+
+	assert.True(t, breaker.Allow())
+	assert.Equal(t, breakerHalfOpen, breaker.State())
+	assert.False(t, breaker.Allow())
+	breaker.Record(true)
+	assert.Equal(t, breakerClosed, breaker.State())
+	assert.True(t, breaker.Allow())
+}
+
+func TestBreakerReopensIfProbeFails(t *testing.T) {
+	breaker := newBreaker("primary", 1, 10*time.Millisecond)
+	breaker.Allow()
+	breaker.Record(false)
+	time.Sleep(20 * time.Millisecond)
+
+	assert.True(t, breaker.Allow())
+	breaker.Record(false)
+	assert.Equal(t, breakerOpen, breaker.State())
+	assert.False(t, breaker.Allow())
+}
+
+func TestBreakerAllowsAnotherProbeIfAbandoned(t *testing.T) {
+	breaker := newBreaker("primary", 1, 10*time.Millisecond)
+	breaker.Allow()
+	breaker.Record(false)
+	time.Sleep(20 * time.Millisecond)
+
+	assert.True(t, breaker.Allow())
+	breaker.Abandon()
+	assert.True(t, breaker.Allow())
+}
@@ -0,0 +1,89 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/textproto"
+	"time"
+
+	"portfolio-back/config"
+)
+
+// Failover submits emails to the first available relay out of an ordered list,
+// moving on to the next one when a relay fails.
+type Failover struct {
+	relays []*relay
+}
+
+type relay struct {
+	name      string
+	transport Transport
+	breaker   *breaker
+}
+
+// NewFailover builds an SMTP transport for each relay listed in SMTP_RELAYS.
+// Each relay reads its settings prefixed by its name, like PRIMARY_SMTP_SERVER_DOMAIN,
+// and falls back to the unprefixed settings.
+func NewFailover(getEnv func(string) string) (*Failover, error) {
+	failover := &Failover{}
+	for _, name := range config.List(getEnv, "SMTP_RELAYS") {
+		relayGetEnv := config.Prefixed(getEnv, name)
+		transport, err := NewSmtp(relayGetEnv)
+		if err != nil {
+			failover.Close()
+			return nil, fmt.Errorf("invalid configuration of SMTP relay %s: %w", name, err)
+		}
+		failover.relays = append(failover.relays, &relay{
+			name:      name,
+			transport: transport,
+			breaker: newBreaker(
+				name,
+				max(1, config.Int(relayGetEnv, "SMTP_BREAKER_THRESHOLD", 3)),
+				config.Milliseconds(relayGetEnv, "SMTP_BREAKER_OPEN_DURATION", 30*time.Second),
+			),
+		})
+	}
+	if len(failover.relays) == 0 {
+		return nil, errors.New("SMTP_RELAYS lists no relay")
+	}
+	return failover, nil
+}
+
+func (failover *Failover) Send(ctx context.Context, message *Message) error {
+	var errs []error
+	for _, relay := range failover.relays {
+		if !relay.breaker.Allow() {
+			continue
+		}
+		err := relay.transport.Send(ctx, message)
+		if err == nil {
+			relay.breaker.Record(true)
+			return nil
+		}
+		if ctx.Err() != nil {
+			relay.breaker.Abandon()
+			return err
+		}
+		// Permanent rejections come from a working relay, and the next relays would reject the email as well.
+		var protocolErr *textproto.Error
+		if errors.As(err, &protocolErr) && protocolErr.Code >= 500 {
+			relay.breaker.Record(true)
+			return err
+		}
+		relay.breaker.Record(false)
+		log.Printf("[WARN] SMTP relay %s failed: %s\n", relay.name, err)
+		errs = append(errs, fmt.Errorf("SMTP relay %s: %w", relay.name, err))
+	}
+	if len(errs) == 0 {
+		return errors.New("all SMTP relays are unavailable")
+	}
+	return errors.Join(errs...)
+}
+
+func (failover *Failover) Close() {
+	for _, relay := range failover.relays {
+		relay.transport.Close()
+	}
+}
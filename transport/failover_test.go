@@ -0,0 +1,160 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net/textproto"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// switchableTransport fails while its failing flag is set, and counts the sends.
+type switchableTransport struct {
+	failing atomic.Bool
+	sends   atomic.Int32
+}
+
+func (transport *switchableTransport) Send(ctx context.Context, _ *Message) error {
+	transport.sends.Add(1)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if transport.failing.Load() {
+		return errors.New("relay unavailable")
+	}
+	return nil
+}
+
+func (transport *switchableTransport) Close() {}
+
+// rejectingTransport rejects every email with the SMTP reply code.
+type rejectingTransport struct {
+	code int
+}
+
+func (transport rejectingTransport) Send(context.Context, *Message) error {
+	return &textproto.Error{Code: transport.code, Msg: "rejected"}
+}
+
+func (rejectingTransport) Close() {}
+
+func TestFailoverUsesPrimaryRelay(t *testing.T) {
+	failover, primary, backup := newTestFailover(3, time.Minute)
+	assert.Nil(t, failover.Send(context.Background(), newTestMessage()))
+	assert.Equal(t, int32(1), primary.sends.Load())
+	assert.Equal(t, int32(0), backup.sends.Load())
+}
+
+func TestFailoverFallsBackToNextRelay(t *testing.T) {
+	failover, primary, backup := newTestFailover(3, time.Minute)
+	primary.failing.Store(true)
+	assert.Nil(t, failover.Send(context.Background(), newTestMessage()))
+	assert.Equal(t, int32(1), primary.sends.Load())
+	assert.Equal(t, int32(1), backup.sends.Load())
+}
+
+func TestFailoverSkipsRelayWithOpenBreaker(t *testing.T) {
+	failover, primary, backup := newTestFailover(2, time.Minute)
+	primary.failing.Store(true)
+	for range 4 {
+		assert.Nil(t, failover.Send(context.Background(), newTestMessage()))
+	}
+	assert.Equal(t, int32(2), primary.sends.Load())
+	assert.Equal(t, int32(4), backup.sends.Load())
+}
+
+func TestFailoverProbesPrimaryRelayBack(t *testing.T) {
+	failover, primary, backup := newTestFailover(1, 10*time.Millisecond)
+	primary.failing.Store(true)
+	assert.Nil(t, failover.Send(context.Background(), newTestMessage()))
+	require.Equal(t, breakerOpen, failover.relays[0].breaker.State())
+
+	primary.failing.Store(false)
+	time.Sleep(20 * time.Millisecond)
+	assert.Nil(t, failover.Send(context.Background(), newTestMessage()))
+	assert.Equal(t, breakerClosed, failover.relays[0].breaker.State())
+	assert.Equal(t, int32(2), primary.sends.Load())
+	assert.Equal(t, int32(1), backup.sends.Load())
+}
+
+func TestFailoverFailsWhenAllRelaysFail(t *testing.T) {
+	failover, primary, backup := newTestFailover(1, time.Minute)
+	primary.failing.Store(true)
+	backup.failing.Store(true)
+	err := failover.Send(context.Background(), newTestMessage())
+	assert.ErrorContains(t, err, "SMTP relay primary")
+	assert.ErrorContains(t, err, "SMTP relay backup")
+
+	err = failover.Send(context.Background(), newTestMessage())
+	assert.ErrorContains(t, err, "all SMTP relays are unavailable")
+}
+
+func TestFailoverReturnsPermanentRejections(t *testing.T) {
+	failover, _, backup := newTestFailover(1, time.Minute)
+	failover.relays[0].transport = rejectingTransport{code: 552}
+	for range 2 {
+		var protocolErr *textproto.Error
+		require.ErrorAs(t, failover.Send(context.Background(), newTestMessage()), &protocolErr)
+		assert.Equal(t, 552, protocolErr.Code)
+	}
+	assert.Equal(t, breakerClosed, failover.relays[0].breaker.State())
+	assert.Equal(t, int32(0), backup.sends.Load())
+}
+
+func TestFailoverFallsBackOnTemporaryRejections(t *testing.T) {
+	failover, _, backup := newTestFailover(1, time.Minute)
+	failover.relays[0].transport = rejectingTransport{code: 451}
+	assert.Nil(t, failover.Send(context.Background(), newTestMessage()))
+	assert.Equal(t, breakerOpen, failover.relays[0].breaker.State())
+	assert.Equal(t, int32(1), backup.sends.Load())
+}
+
+func TestFailoverDoesNotBlameRelayForCancellation(t *testing.T) {
+	failover, primary, backup := newTestFailover(1, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, failover.Send(ctx, newTestMessage()), context.Canceled)
+	assert.Equal(t, breakerClosed, failover.relays[0].breaker.State())
+	assert.Equal(t, int32(1), primary.sends.Load())
+	assert.Equal(t, int32(0), backup.sends.Load())
+}
+
+func TestNewFailoverReadsPrefixedRelaySettings(t *testing.T) {
+	mailTransport, err := newTransport("smtp", mockGetEnv(map[string]string{
+		"SMTP_RELAYS":                   "PRIMARY, BACKUP",
+		"PRIMARY_SMTP_SERVER_DOMAIN":    "smtp.primary.com",
+		"BACKUP_SMTP_SERVER_DOMAIN":     "smtp.backup.com",
+		"BACKUP_SMTP_BREAKER_THRESHOLD": "5",
+	}))
+	require.Nil(t, err, "Failed to build failover transport: %s\n", err)
+	defer mailTransport.Close()
+
+	require.IsType(t, &Failover{}, mailTransport)
+	relays := mailTransport.(*Failover).relays
+	require.Len(t, relays, 2)
+	assert.Equal(t, "PRIMARY", relays[0].name)
+	assert.Equal(t, 3, relays[0].breaker.threshold)
+	assert.Equal(t, "BACKUP", relays[1].name)
+	assert.Equal(t, 5, relays[1].breaker.threshold)
+}
+
+func TestNewFailoverFailsOnInvalidRelay(t *testing.T) {
+	_, err := NewFailover(mockGetEnv(map[string]string{
+		"SMTP_RELAYS":           "PRIMARY",
+		"PRIMARY_SMTP_TLS_MODE": "sometimes",
+	}))
+	assert.ErrorContains(t, err, "PRIMARY")
+}
+
+func newTestFailover(threshold int, openDuration time.Duration) (*Failover, *switchableTransport, *switchableTransport) {
+	primary := &switchableTransport{}
+	backup := &switchableTransport{}
+	return &Failover{relays: []*relay{
+		{name: "primary", transport: primary, breaker: newBreaker("primary", threshold, openDuration)},
+		{name: "backup", transport: backup, breaker: newBreaker("backup", threshold, openDuration)},
+	}}, primary, backup
+}
@@ -0,0 +1,48 @@
+package transport
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// File writes emails as .eml files into a local directory, for development.
+type File struct {
+	directory string
+}
+
+func NewFile(getEnv func(string) string) (*File, error) {
+	directory := getEnv("MAIL_FILE_DIRECTORY")
+	if directory == "" {
+		return nil, fmt.Errorf("MAIL_FILE_DIRECTORY is required by the file mail transport")
+	}
+	err := os.MkdirAll(directory, 0o750)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &File{directory: directory}, nil
+}
+
+func (transport *File) Send(_ context.Context, message *Message) error {
+	path := filepath.Join(transport.directory, newUniqueFileName(".eml"))
+	err := os.WriteFile(path, message.Bytes(), 0o640)
+	if err != nil {
+		return err
+	}
+	log.Printf("[INFO] Email written to %s\n", path)
+	return nil
+}
+
+func (transport *File) Close() {}
+
+// newUniqueFileName returns a unique file name, which sorts files chronologically.
+func newUniqueFileName(extension string) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%s%s", time.Now().UTC().Format("20060102T150405.000000000Z"), hex.EncodeToString(suffix), extension)
+}
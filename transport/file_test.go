@@ -0,0 +1,35 @@
+package transport
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileWritesEml(t *testing.T) {
+	directory := filepath.Join(t.TempDir(), "mails")
+	mailTransport, err := NewFile(mockGetEnv(map[string]string{"MAIL_FILE_DIRECTORY": directory}))
+	require.Nil(t, err, "Failed to build file mail transport: %s\n", err)
+
+	message := newTestMessage()
+	for range 2 {
+		err = mailTransport.Send(context.Background(), message)
+		assert.Nil(t, err)
+	}
+
+	emlFiles, err := filepath.Glob(filepath.Join(directory, "*.eml"))
+	require.Nil(t, err)
+	require.Len(t, emlFiles, 2)
+	content, err := os.ReadFile(emlFiles[0])
+	require.Nil(t, err)
+	assert.Equal(t, message.Bytes(), content)
+}
+
+func TestFileRequiresDirectory(t *testing.T) {
+	_, err := NewFile(mockGetEnv(nil))
+	assert.NotNil(t, err)
+}
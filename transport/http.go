@@ -0,0 +1,99 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Http submits emails as JSON to the HTTPS API of a transactional mail provider.
+type Http struct {
+	url        string
+	apiKey     string
+	httpClient *http.Client
+}
+
+type httpRequestBody struct {
+	From    string   `json:"from"`
+	To      []string `json:"to"`
+	ReplyTo string   `json:"reply_to,omitempty"`
+	Subject string   `json:"subject"`
+	Text    string   `json:"text"`
+	Html    string   `json:"html,omitempty"`
+
+	Attachments []*httpAttachment `json:"attachments,omitempty"`
+}
+
+type httpAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	// Encoded in base64
+	Content []byte `json:"content"`
+}
+
+func NewHttp(getEnv func(string) string) (*Http, error) {
+	url := getEnv("MAIL_HTTP_API_URL")
+	if url == "" {
+		return nil, fmt.Errorf("MAIL_HTTP_API_URL is required by the http mail transport")
+	}
+	return &Http{
+		url:        url,
+		apiKey:     getEnv("MAIL_HTTP_API_KEY"),
+		httpClient: &http.Client{},
+	}, nil
+}
+
+func (transport *Http) Send(ctx context.Context, message *Message) error {
+	var replyTo string
+	if message.ReplyTo != nil {
+		replyTo = message.ReplyTo.String()
+	}
+	attachments := make([]*httpAttachment, len(message.Attachments))
+	for i, attachment := range message.Attachments {
+		attachments[i] = &httpAttachment{
+			Filename:    attachment.Filename,
+			ContentType: attachment.ContentType,
+			Content:     attachment.Content,
+		}
+	}
+	requestBody, err := json.Marshal(&httpRequestBody{
+		From:    message.From,
+		To:      message.To,
+		ReplyTo: replyTo,
+		Subject: message.Subject,
+		Text:    message.Text,
+		Html:    message.Html,
+
+		Attachments: attachments,
+	})
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, transport.url, bytes.NewReader(requestBody))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Accept", "application/json")
+	if transport.apiKey != "" {
+		request.Header.Set("Authorization", "Bearer "+transport.apiKey)
+	}
+
+	response, err := transport.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		errorDetails, _ := io.ReadAll(io.LimitReader(response.Body, 512))
+		return fmt.Errorf("mail API responded with status %s: %s", response.Status, errorDetails)
+	}
+	return nil
+}
+
+func (transport *Http) Close() {
+	transport.httpClient.CloseIdleConnections()
+}
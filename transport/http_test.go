@@ -0,0 +1,101 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHttpPostsMessage(t *testing.T) {
+	requestsReceived := 0
+	mailApi := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		requestsReceived++
+		assert.Equal(t, http.MethodPost, request.Method)
+		assert.Equal(t, "application/json", request.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer test key", request.Header.Get("Authorization"))
+
+		var requestBody *httpRequestBody
+		err := json.NewDecoder(request.Body).Decode(&requestBody)
+		require.Nil(t, err)
+		assert.Equal(t, &httpRequestBody{
+			From:    sourceEmailAddress,
+			To:      []string{targetEmailAddress},
+			Subject: "Test subject",
+			Text:    "Test body",
+		}, requestBody)
+		response.WriteHeader(http.StatusAccepted)
+	}))
+	defer mailApi.Close()
+
+	mailTransport := newTestHttpTransport(t, mailApi.URL)
+	err := mailTransport.Send(context.Background(), newTestMessage())
+	assert.Nil(t, err)
+	assert.Equal(t, 1, requestsReceived)
+}
+
+func TestHttpPostsReplyTo(t *testing.T) {
+	mailApi := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		var requestBody *httpRequestBody
+		err := json.NewDecoder(request.Body).Decode(&requestBody)
+		require.Nil(t, err)
+		assert.Equal(t, `"Jane Doe" <jane@test.com>`, requestBody.ReplyTo)
+		response.WriteHeader(http.StatusAccepted)
+	}))
+	defer mailApi.Close()
+
+	message := newTestMessage()
+	message.ReplyTo = &mail.Address{Name: "Jane Doe", Address: "jane@test.com"}
+	err := newTestHttpTransport(t, mailApi.URL).Send(context.Background(), message)
+	assert.Nil(t, err)
+}
+
+func TestHttpPostsAttachments(t *testing.T) {
+	mailApi := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, request *http.Request) {
+		var requestBody map[string]any
+		err := json.NewDecoder(request.Body).Decode(&requestBody)
+		require.Nil(t, err)
+		assert.Equal(t, []any{map[string]any{
+			"filename":     "job.pdf",
+			"content_type": "application/pdf",
+			"content":      "JVBERi0xLjQ=",
+		}}, requestBody["attachments"])
+		response.WriteHeader(http.StatusAccepted)
+	}))
+	defer mailApi.Close()
+
+	message := newTestMessage()
+	message.Attachments = []*Attachment{{Filename: "job.pdf", ContentType: "application/pdf", Content: []byte("%PDF-1.4")}}
+	err := newTestHttpTransport(t, mailApi.URL).Send(context.Background(), message)
+	assert.Nil(t, err)
+}
+
+func TestHttpFailsOnErrorStatus(t *testing.T) {
+	mailApi := httptest.NewServer(http.HandlerFunc(func(response http.ResponseWriter, _ *http.Request) {
+		http.Error(response, `{"message":"Invalid sender"}`, http.StatusUnprocessableEntity)
+	}))
+	defer mailApi.Close()
+
+	mailTransport := newTestHttpTransport(t, mailApi.URL)
+	err := mailTransport.Send(context.Background(), newTestMessage())
+	assert.ErrorContains(t, err, "Invalid sender")
+}
+
+func TestHttpRequiresUrl(t *testing.T) {
+	_, err := NewHttp(mockGetEnv(nil))
+	assert.NotNil(t, err)
+}
+
+func newTestHttpTransport(t *testing.T, url string) *Http {
+	mailTransport, err := NewHttp(mockGetEnv(map[string]string{
+		"MAIL_HTTP_API_URL": url,
+		"MAIL_HTTP_API_KEY": "test key",
+	}))
+	require.Nil(t, err, "Failed to build http mail transport: %s\n", err)
+	return mailTransport
+}
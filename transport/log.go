@@ -0,0 +1,20 @@
+package transport
+
+import (
+	"context"
+	"log"
+)
+
+// Log prints emails to the logs instead of delivering them, for dry runs.
+type Log struct{}
+
+func NewLog() *Log {
+	return &Log{}
+}
+
+func (transport *Log) Send(_ context.Context, message *Message) error {
+	log.Printf("[INFO] Dry run, not delivering email from %s to %v:\n%s\n", message.From, message.To, message.Bytes())
+	return nil
+}
+
+func (transport *Log) Close() {}
@@ -0,0 +1,22 @@
+package transport
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogPrintsMessage(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	err := NewLog().Send(context.Background(), newTestMessage())
+	assert.Nil(t, err)
+	assert.Contains(t, logs.String(), "Subject: Test subject")
+	assert.Contains(t, logs.String(), "Test body")
+}
@@ -0,0 +1,272 @@
+package transport
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxLineLength is the line length recommended by RFC 5322, excluding the CRLF.
+const maxLineLength = 78
+
+// maxEncodedWordBytes keeps base64 encoded words short enough to fit on a header line
+// next to the header name.
+const maxEncodedWordBytes = 39
+
+// maxEncodedLineLength is the line length imposed by RFC 2045 on encoded bodies, excluding the CRLF.
+const maxEncodedLineLength = 76
+
+// Message is an email to deliver, independently of the delivery mechanism.
+type Message struct {
+	// Identifies the message across delivery attempts, without the angle brackets.
+	Id      string
+	Date    time.Time
+	From    string
+	To      []string
+	Subject string
+	Text    string
+	// Optional HTML alternative to the plain text.
+	Html string `json:",omitempty"`
+	// Optional address to which replies are sent, unlike From which must stay aligned with SPF and DMARC.
+	ReplyTo     *mail.Address `json:",omitempty"`
+	Attachments []*Attachment `json:",omitempty"`
+}
+
+// Attachment is a file attached to a message.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Content     []byte
+}
+
+// NewMessage builds a message dated now, with a unique ID in the domain of the sender.
+func NewMessage(from string, to []string, subject string, text string) *Message {
+	return &Message{
+		Id:      newMessageId(from),
+		Date:    time.Now(),
+		From:    from,
+		To:      to,
+		Subject: subject,
+		Text:    text,
+	}
+}
+
+// Bytes renders the message in the Internet Message Format, with quoted-printable UTF-8 bodies.
+// Messages with an HTML body are sent as multipart/alternative, with the plain text as fallback,
+// and messages with attachments as multipart/mixed.
+func (message *Message) Bytes() []byte {
+	var buffer bytes.Buffer
+	writeHeader(&buffer, "From", formatAddresses([]string{message.From}))
+	writeHeader(&buffer, "To", formatAddresses(message.To))
+	if message.ReplyTo != nil {
+		writeHeader(&buffer, "Reply-To", message.ReplyTo.String())
+	}
+	writeHeader(&buffer, "Subject", encodeHeaderText(message.Subject))
+	writeHeader(&buffer, "Date", message.Date.Format(time.RFC1123Z))
+	writeHeader(&buffer, "Message-ID", "<"+message.Id+">")
+	writeHeader(&buffer, "MIME-Version", "1.0")
+	content := message.content()
+	for _, header := range content.headers {
+		writeHeader(&buffer, header.name, header.value)
+	}
+	buffer.WriteString("\r\n")
+	buffer.Write(content.body)
+	return buffer.Bytes()
+}
+
+// entity is a MIME entity, which headers are written in order.
+type entity struct {
+	headers []entityHeader
+	body    []byte
+}
+
+type entityHeader struct {
+	name  string
+	value string
+}
+
+func (message *Message) content() *entity {
+	content := textEntity("text/plain", message.Text)
+	if message.Html != "" {
+		content = multipartEntity("alternative", newBoundary(message.Id, "alternative"), []*entity{
+			content,
+			textEntity("text/html", message.Html),
+		})
+	}
+	if len(message.Attachments) > 0 {
+		parts := []*entity{content}
+		for _, attachment := range message.Attachments {
+			parts = append(parts, attachmentEntity(attachment))
+		}
+		content = multipartEntity("mixed", newBoundary(message.Id, "mixed"), parts)
+	}
+	return content
+}
+
+func textEntity(mediaType string, content string) *entity {
+	return &entity{
+		headers: []entityHeader{
+			{"Content-Type", mime.FormatMediaType(mediaType, map[string]string{"charset": "utf-8"})},
+			{"Content-Transfer-Encoding", "quoted-printable"},
+		},
+		body: encodeQuotedPrintable(content),
+	}
+}
+
+func attachmentEntity(attachment *Attachment) *entity {
+	return &entity{
+		headers: []entityHeader{
+			{"Content-Type", mime.FormatMediaType(attachment.ContentType, map[string]string{"name": attachment.Filename})},
+			{"Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename})},
+			{"Content-Transfer-Encoding", "base64"},
+		},
+		body: encodeBase64(attachment.Content),
+	}
+}
+
+func multipartEntity(subtype string, boundary string, parts []*entity) *entity {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	writer.SetBoundary(boundary)
+	for _, part := range parts {
+		partHeader := textproto.MIMEHeader{}
+		for _, header := range part.headers {
+			partHeader.Set(header.name, header.value)
+		}
+		partWriter, _ := writer.CreatePart(partHeader)
+		partWriter.Write(part.body)
+	}
+	writer.Close()
+	return &entity{
+		headers: []entityHeader{
+			{"Content-Type", mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": boundary})},
+		},
+		body: body.Bytes(),
+	}
+}
+
+// newBoundary derives the multipart boundary from the message ID, so that rendering is deterministic.
+// Neither quoted-printable nor base64 bodies can contain the boundary, which starts with "=_".
+func newBoundary(messageId string, subtype string) string {
+	hash := sha256.Sum256([]byte(messageId + "/" + subtype))
+	return "=_" + hex.EncodeToString(hash[:12])
+}
+
+func newMessageId(from string) string {
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 && at < len(from)-1 {
+		domain = from[at+1:]
+	}
+	random := make([]byte, 16)
+	rand.Read(random)
+	return fmt.Sprintf("%s@%s", hex.EncodeToString(random), domain)
+}
+
+func formatAddresses(addresses []string) string {
+	formatted := make([]string, len(addresses))
+	for i, address := range addresses {
+		formatted[i] = (&mail.Address{Address: address}).String()
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// writeHeader folds the header at whitespace, so that lines stay within maxLineLength when possible.
+func writeHeader(buffer *bytes.Buffer, name string, value string) {
+	value = neutralizeControlCharacters(value)
+	line := name + ":"
+	for _, word := range strings.Fields(value) {
+		if len(line)+1+len(word) > maxLineLength && strings.TrimSpace(line) != name+":" {
+			buffer.WriteString(line + "\r\n")
+			line = ""
+		}
+		line += " " + word
+	}
+	buffer.WriteString(line + "\r\n")
+}
+
+// encodeHeaderText encodes non-ASCII text as per RFC 2047. Text which merely looks like
+// encoded words is encoded as well, so that readers display it verbatim.
+func encodeHeaderText(value string) string {
+	value = neutralizeControlCharacters(value)
+	if !strings.Contains(value, "=?") {
+		return mime.QEncoding.Encode("utf-8", value)
+	}
+	var encodedWords []string
+	for len(value) > 0 {
+		chunkLength := min(len(value), maxEncodedWordBytes)
+		for chunkLength < len(value) && chunkLength > 1 && !utf8.RuneStart(value[chunkLength]) {
+			chunkLength--
+		}
+		encodedWords = append(encodedWords, "=?utf-8?b?"+base64.StdEncoding.EncodeToString([]byte(value[:chunkLength]))+"?=")
+		value = value[chunkLength:]
+	}
+	return strings.Join(encodedWords, " ")
+}
+
+// neutralizeControlCharacters turns control characters into whitespace,
+// so that header values can never inject other headers.
+func neutralizeControlCharacters(value string) string {
+	return strings.Map(func(char rune) rune {
+		if unicode.IsControl(char) {
+			return ' '
+		}
+		return char
+	}, value)
+}
+
+// encodeBase64 wraps the encoded content at the line length imposed by RFC 2045.
+func encodeBase64(content []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(content)
+	var wrapped bytes.Buffer
+	for len(encoded) > maxEncodedLineLength {
+		wrapped.WriteString(encoded[:maxEncodedLineLength] + "\r\n")
+		encoded = encoded[maxEncodedLineLength:]
+	}
+	wrapped.WriteString(encoded)
+	return wrapped.Bytes()
+}
+
+// encodeQuotedPrintable normalizes line endings to CRLF, then encodes the text as per RFC 2045.
+// Leading dots are encoded too, so that no line of the body can end the SMTP DATA.
+func encodeQuotedPrintable(text string) []byte {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+
+	var encoded bytes.Buffer
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 {
+			encoded.WriteString("\r\n")
+		}
+		lineLength := 0
+		for j := 0; j < len(line); j++ {
+			char := line[j]
+			token := string(char)
+			isTrailingWhitespace := (char == ' ' || char == '\t') && j == len(line)-1
+			if (char < ' ' && char != '\t') || char > '~' || char == '=' || isTrailingWhitespace {
+				token = fmt.Sprintf("=%02X", char)
+			}
+			// Keeps room for the soft line break
+			if lineLength+len(token) > maxEncodedLineLength-1 {
+				encoded.WriteString("=\r\n")
+				lineLength = 0
+			}
+			if char == '.' && lineLength == 0 {
+				token = "=2E"
+			}
+			encoded.WriteString(token)
+			lineLength += len(token)
+		}
+	}
+	return encoded.Bytes()
+}
@@ -0,0 +1,207 @@
+package transport
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageHeaders(t *testing.T) {
+	parsed := parseMessage(t, newTestMessage())
+
+	from, err := parsed.Header.AddressList("From")
+	require.Nil(t, err, "Failed to parse From: %s\n", err)
+	assert.Equal(t, []*mail.Address{{Address: sourceEmailAddress}}, from)
+	to, err := parsed.Header.AddressList("To")
+	require.Nil(t, err, "Failed to parse To: %s\n", err)
+	assert.Equal(t, []*mail.Address{{Address: targetEmailAddress}}, to)
+	assert.Equal(t, "Test subject", parsed.Header.Get("Subject"))
+	date, err := parsed.Header.Date()
+	require.Nil(t, err, "Failed to parse Date: %s\n", err)
+	assert.True(t, date.Equal(time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "<0123456789abcdef@test.com>", parsed.Header.Get("Message-ID"))
+	assert.Equal(t, "1.0", parsed.Header.Get("MIME-Version"))
+	assert.Equal(t, "text/plain; charset=utf-8", parsed.Header.Get("Content-Type"))
+	assert.Equal(t, "quoted-printable", parsed.Header.Get("Content-Transfer-Encoding"))
+	assert.Equal(t, "Test body", readBody(t, parsed))
+}
+
+func TestMessageEncodesNonAsciiSubject(t *testing.T) {
+	message := newTestMessage()
+	message.Subject = "Réponse à votre message – merci beaucoup pour votre intérêt envers mon portfolio"
+	raw := message.Bytes()
+	assert.NotContains(t, string(headerOf(raw)), "é")
+
+	parsed := parseMessage(t, message)
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	require.Nil(t, err, "Failed to decode Subject: %s\n", err)
+	assert.Equal(t, message.Subject, subject)
+}
+
+func TestMessageFoldsLongHeaders(t *testing.T) {
+	message := newTestMessage()
+	message.Subject = strings.Repeat("word ", 40)
+	message.To = []string{"first@test.com", "second@test.com", "third@test.com", "fourth@test.com", "fifth@test.com"}
+	for _, line := range strings.Split(string(headerOf(message.Bytes())), "\r\n") {
+		assert.LessOrEqual(t, len(line), maxLineLength, "Header line is too long: %q", line)
+	}
+
+	parsed := parseMessage(t, message)
+	assert.Equal(t, strings.TrimSpace(message.Subject), parsed.Header.Get("Subject"))
+	to, err := parsed.Header.AddressList("To")
+	require.Nil(t, err, "Failed to parse To: %s\n", err)
+	assert.Len(t, to, 5)
+}
+
+func TestMessageEncodesBody(t *testing.T) {
+	message := newTestMessage()
+	message.Text = "Bonjour,\nVoici un café ☕ = 1€.\r\n.\r\n..leading dots\rtrailing space \n" + strings.Repeat("long line ", 30)
+	raw := message.Bytes()
+	body := raw[len(headerOf(raw)):]
+
+	for _, line := range strings.Split(string(body), "\r\n") {
+		assert.LessOrEqual(t, len(line), maxEncodedLineLength, "Body line is too long: %q", line)
+		assert.False(t, strings.HasPrefix(line, "."), "Body line starts with a dot: %q", line)
+		assert.False(t, strings.HasSuffix(line, " "), "Body line ends with a space: %q", line)
+		for _, char := range []byte(line) {
+			assert.True(t, char >= ' ' && char <= '~', "Body line is not printable ASCII: %q", line)
+		}
+	}
+	assert.NotContains(t, strings.ReplaceAll(string(body), "\r\n", ""), "\n")
+
+	expectedText := "Bonjour,\r\nVoici un café ☕ = 1€.\r\n.\r\n..leading dots\r\ntrailing space \r\n" + strings.Repeat("long line ", 30)
+	assert.Equal(t, expectedText, readBody(t, parseMessage(t, message)))
+}
+
+func TestNewMessage(t *testing.T) {
+	message := NewMessage(sourceEmailAddress, []string{targetEmailAddress}, "Test subject", "Test body")
+	assert.WithinDuration(t, time.Now(), message.Date, time.Second)
+	assert.True(t, strings.HasSuffix(message.Id, "@test.com"))
+	assert.NotEqual(t, message.Id, NewMessage(sourceEmailAddress, nil, "", "").Id)
+	assert.True(t, strings.HasSuffix(NewMessage("", nil, "", "").Id, "@localhost"))
+}
+
+func parseMessage(t *testing.T, message *Message) *mail.Message {
+	parsed, err := mail.ReadMessage(bytes.NewReader(message.Bytes()))
+	require.Nil(t, err, "Failed to parse message: %s\n", err)
+	return parsed
+}
+
+func readBody(t *testing.T, parsed *mail.Message) string {
+	body, err := io.ReadAll(quotedprintable.NewReader(parsed.Body))
+	require.Nil(t, err, "Failed to decode body: %s\n", err)
+	return string(body)
+}
+
+func headerOf(raw []byte) []byte {
+	return raw[:bytes.Index(raw, []byte("\r\n\r\n"))+4]
+}
+
+func TestMessageNeutralizesControlCharactersInHeaders(t *testing.T) {
+	message := newTestMessage()
+	message.Subject = "Hello\r\nBcc: attacker@test.com\x00"
+	parsed := parseMessage(t, message)
+	assert.Empty(t, parsed.Header.Get("Bcc"))
+	assert.Equal(t, "Hello Bcc: attacker@test.com", parsed.Header.Get("Subject"))
+}
+
+func TestMessageEncodesTextLookingLikeEncodedWords(t *testing.T) {
+	message := newTestMessage()
+	message.Subject = "=?utf-8?q?Hello=0D=0ABcc:_attacker@test.com?= and a rather long tail which spans several encoded words"
+	parsed := parseMessage(t, message)
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	require.Nil(t, err, "Failed to decode Subject: %s\n", err)
+	assert.Equal(t, message.Subject, subject)
+	for _, line := range strings.Split(string(headerOf(message.Bytes())), "\r\n") {
+		assert.LessOrEqual(t, len(line), maxLineLength, "Header line is too long: %q", line)
+	}
+}
+
+func TestMessageReplyTo(t *testing.T) {
+	message := newTestMessage()
+	assert.Empty(t, parseMessage(t, message).Header.Get("Reply-To"))
+
+	message.ReplyTo = &mail.Address{Name: "Zoë Dupont", Address: "zoe@test.com"}
+	assert.NotContains(t, string(headerOf(message.Bytes())), "ë")
+	replyTo, err := parseMessage(t, message).Header.AddressList("Reply-To")
+	require.Nil(t, err, "Failed to parse Reply-To: %s\n", err)
+	assert.Equal(t, []*mail.Address{message.ReplyTo}, replyTo)
+}
+
+func TestMessageWithHtmlAlternative(t *testing.T) {
+	message := newTestMessage()
+	message.Html = "<p>Test body with a long enough line to be wrapped by the quoted-printable encoding, café</p>"
+	raw := message.Bytes()
+	assert.Equal(t, raw, message.Bytes())
+
+	parsed := parseMessage(t, message)
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.Nil(t, err, "Failed to parse Content-Type: %s\n", err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	for _, expected := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.Html},
+	} {
+		part, err := reader.NextPart()
+		require.Nil(t, err, "Failed to read part: %s\n", err)
+		assert.Equal(t, expected.contentType, part.Header.Get("Content-Type"))
+		content, err := io.ReadAll(part)
+		require.Nil(t, err, "Failed to decode part: %s\n", err)
+		assert.Equal(t, expected.content, string(content))
+	}
+	_, err = reader.NextPart()
+	assert.Equal(t, io.EOF, err)
+}
+
+func TestMessageWithAttachments(t *testing.T) {
+	message := newTestMessage()
+	message.Html = "<p>Test body</p>"
+	pdf := append([]byte("%PDF-1.4\n"), bytes.Repeat([]byte{0xff, 0x00, '='}, 100)...)
+	message.Attachments = []*Attachment{
+		{Filename: "job description.pdf", ContentType: "application/pdf", Content: pdf},
+		{Filename: "café.txt", ContentType: "text/plain", Content: []byte("Hello")},
+	}
+	raw := message.Bytes()
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		assert.LessOrEqual(t, len(line), maxLineLength, "Line is too long: %q", line)
+	}
+
+	parsed := parseMessage(t, message)
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.Nil(t, err, "Failed to parse Content-Type: %s\n", err)
+	assert.Equal(t, "multipart/mixed", mediaType)
+
+	reader := multipart.NewReader(parsed.Body, params["boundary"])
+	part, err := reader.NextPart()
+	require.Nil(t, err, "Failed to read body part: %s\n", err)
+	mediaType, _, err = mime.ParseMediaType(part.Header.Get("Content-Type"))
+	require.Nil(t, err, "Failed to parse body part Content-Type: %s\n", err)
+	assert.Equal(t, "multipart/alternative", mediaType)
+
+	for _, attachment := range message.Attachments {
+		part, err := reader.NextPart()
+		require.Nil(t, err, "Failed to read attachment: %s\n", err)
+		assert.Equal(t, attachment.Filename, part.FileName())
+		mediaType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		require.Nil(t, err, "Failed to parse attachment Content-Type: %s\n", err)
+		assert.Equal(t, attachment.ContentType, mediaType)
+		assert.Equal(t, "base64", part.Header.Get("Content-Transfer-Encoding"))
+		content, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, part))
+		require.Nil(t, err, "Failed to decode attachment: %s\n", err)
+		assert.Equal(t, attachment.Content, content)
+	}
+	_, err = reader.NextPart()
+	assert.Equal(t, io.EOF, err)
+}
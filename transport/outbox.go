@@ -0,0 +1,253 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"portfolio-back/config"
+)
+
+const (
+	outboxPendingDirectory    = "pending"
+	outboxDeadLetterDirectory = "dead"
+)
+
+// Outbox persists emails to a local directory, then delivers them in the background
+// through the next transport, retrying with exponential backoff.
+// Emails which still fail after the maximum number of attempts are moved to a dead letter directory.
+type Outbox struct {
+	next            Transport
+	pendingPath     string
+	deadLetterPath  string
+	maxAttempts     int
+	retryBackoff    time.Duration
+	maxRetryBackoff time.Duration
+	pollInterval    time.Duration
+	deliveryTimeout time.Duration
+	flushTimeout    time.Duration
+
+	wakeUp       chan struct{}
+	stopWorker   context.CancelFunc
+	workerExited chan struct{}
+	// Prevents concurrent rewrites of the same item.
+	itemsMutex sync.Mutex
+}
+
+type outboxItem struct {
+	Message       *Message
+	Attempts      int
+	NextAttemptAt time.Time
+	LastError     string
+}
+
+func NewOutbox(next Transport, getEnv func(string) string) (*Outbox, error) {
+	directory := getEnv("OUTBOX_DIRECTORY")
+	outbox := &Outbox{
+		next:            next,
+		pendingPath:     filepath.Join(directory, outboxPendingDirectory),
+		deadLetterPath:  filepath.Join(directory, outboxDeadLetterDirectory),
+		maxAttempts:     max(1, config.Int(getEnv, "OUTBOX_MAX_ATTEMPTS", 5)),
+		retryBackoff:    config.Milliseconds(getEnv, "OUTBOX_RETRY_BACKOFF", time.Second),
+		maxRetryBackoff: config.Milliseconds(getEnv, "OUTBOX_MAX_RETRY_BACKOFF", time.Hour),
+		pollInterval:    config.Milliseconds(getEnv, "OUTBOX_POLL_INTERVAL", time.Second),
+		deliveryTimeout: config.Milliseconds(getEnv, "OUTBOX_DELIVERY_TIMEOUT", 30*time.Second),
+		flushTimeout:    config.Milliseconds(getEnv, "OUTBOX_FLUSH_TIMEOUT", 2*time.Second),
+		wakeUp:          make(chan struct{}, 1),
+		workerExited:    make(chan struct{}),
+	}
+	for _, path := range []string{outbox.pendingPath, outbox.deadLetterPath} {
+		err := os.MkdirAll(path, 0o750)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+		}
+	}
+
+	workerContext, stopWorker := context.WithCancel(context.Background())
+	outbox.stopWorker = stopWorker
+	go outbox.deliverInBackground(workerContext)
+	return outbox, nil
+}
+
+// Send persists the message, which is then delivered asynchronously.
+func (outbox *Outbox) Send(_ context.Context, message *Message) error {
+	itemName := newUniqueFileName(".json")
+	err := outbox.writeItem(filepath.Join(outbox.pendingPath, itemName), &outboxItem{Message: message})
+	if err != nil {
+		return fmt.Errorf("failed to persist email to outbox: %w", err)
+	}
+	log.Printf("[INFO] Email queued in outbox as %s\n", itemName)
+	select {
+	case outbox.wakeUp <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Queued reports that the emails sent through the outbox are delivered asynchronously.
+func (outbox *Outbox) Queued() bool {
+	return true
+}
+
+// Close makes a last attempt at delivering the pending emails, within the flush timeout.
+// The ones left undelivered remain persisted, and are delivered once the outbox is reopened.
+func (outbox *Outbox) Close() {
+	outbox.stopWorker()
+	<-outbox.workerExited
+
+	flushContext, freeContext := context.WithTimeout(context.Background(), outbox.flushTimeout)
+	defer freeContext()
+	log.Println("[INFO] Flushing outbox")
+	outbox.deliverDueItems(flushContext)
+	outbox.next.Close()
+}
+
+func (outbox *Outbox) deliverInBackground(workerContext context.Context) {
+	defer close(outbox.workerExited)
+	ticker := time.NewTicker(outbox.pollInterval)
+	defer ticker.Stop()
+	for {
+		outbox.deliverDueItems(workerContext)
+		select {
+		case <-ticker.C:
+		case <-outbox.wakeUp:
+		case <-workerContext.Done():
+			return
+		}
+	}
+}
+
+func (outbox *Outbox) deliverDueItems(ctx context.Context) {
+	itemPaths, err := filepath.Glob(filepath.Join(outbox.pendingPath, "*.json"))
+	if err != nil {
+		log.Printf("[ERROR] Failed to list outbox items: %s\n", err)
+		return
+	}
+	sort.Strings(itemPaths)
+	for _, itemPath := range itemPaths {
+		if ctx.Err() != nil {
+			return
+		}
+		outbox.deliverIfDue(ctx, itemPath)
+	}
+}
+
+func (outbox *Outbox) deliverIfDue(ctx context.Context, itemPath string) {
+	outbox.itemsMutex.Lock()
+	defer outbox.itemsMutex.Unlock()
+
+	item, err := readItem(itemPath)
+	if err != nil {
+		log.Printf("[ERROR] Failed to read outbox item %s: %s\n", itemPath, err)
+		outbox.moveToDeadLetters(itemPath)
+		return
+	}
+	if time.Now().Before(item.NextAttemptAt) {
+		return
+	}
+
+	deliveryContext, freeContext := context.WithTimeout(ctx, outbox.deliveryTimeout)
+	err = outbox.next.Send(deliveryContext, item.Message)
+	freeContext()
+	if err == nil {
+		log.Printf("[INFO] Delivered outbox item %s\n", filepath.Base(itemPath))
+		os.Remove(itemPath)
+		return
+	}
+	if ctx.Err() != nil {
+		// Interrupted by the shutdown, which does not count as a failed attempt.
+		return
+	}
+
+	item.Attempts++
+	item.LastError = err.Error()
+	if item.Attempts >= outbox.maxAttempts {
+		log.Printf("[ERROR] Giving up on outbox item %s after %d attempts: %s\n", filepath.Base(itemPath), item.Attempts, err)
+		outbox.writeItem(itemPath, item)
+		outbox.moveToDeadLetters(itemPath)
+		return
+	}
+	retryDelay := outbox.retryDelay(item.Attempts)
+	item.NextAttemptAt = time.Now().Add(retryDelay)
+	log.Printf("[WARN] Failed to deliver outbox item %s, retrying in %s: %s\n", filepath.Base(itemPath), retryDelay, err)
+	err = outbox.writeItem(itemPath, item)
+	if err != nil {
+		log.Printf("[ERROR] Failed to update outbox item %s: %s\n", itemPath, err)
+	}
+}
+
+// retryDelay doubles the backoff at every failed attempt, up to the maximum backoff.
+func (outbox *Outbox) retryDelay(attempts int) time.Duration {
+	delay := outbox.retryBackoff
+	for attempt := 1; attempt < attempts && delay > 0 && delay < outbox.maxRetryBackoff; attempt++ {
+		delay *= 2
+	}
+	return min(delay, outbox.maxRetryBackoff)
+}
+
+func (outbox *Outbox) moveToDeadLetters(itemPath string) {
+	err := os.Rename(itemPath, filepath.Join(outbox.deadLetterPath, filepath.Base(itemPath)))
+	if err != nil {
+		log.Printf("[ERROR] Failed to move outbox item %s to dead letters: %s\n", itemPath, err)
+	}
+}
+
+// writeItem writes to a temporary file first, so that items are never read partially written,
+// and syncs both the file and its directory, so that queued items survive a crash.
+func (outbox *Outbox) writeItem(itemPath string, item *outboxItem) error {
+	content, err := json.Marshal(item)
+	if err != nil {
+		return err
+	}
+	temporaryPath := strings.TrimSuffix(itemPath, ".json") + ".tmp"
+	err = writeFileSynced(temporaryPath, content)
+	if err != nil {
+		return err
+	}
+	err = os.Rename(temporaryPath, itemPath)
+	if err != nil {
+		return err
+	}
+	return syncDirectory(filepath.Dir(itemPath))
+}
+
+func writeFileSynced(path string, content []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(content)
+	if err == nil {
+		err = file.Sync()
+	}
+	return errors.Join(err, file.Close())
+}
+
+func syncDirectory(path string) error {
+	directory, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	return errors.Join(directory.Sync(), directory.Close())
+}
+
+func readItem(itemPath string) (*outboxItem, error) {
+	content, err := os.ReadFile(itemPath)
+	if err != nil {
+		return nil, err
+	}
+	var item *outboxItem
+	err = json.Unmarshal(content, &item)
+	if err == nil && item.Message == nil {
+		err = fmt.Errorf("outbox item has no message")
+	}
+	return item, err
+}
@@ -0,0 +1,191 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// flakyTransport fails the given number of sends, then delivers the messages to a channel.
+type flakyTransport struct {
+	mutex     sync.Mutex
+	failures  int
+	attempts  int
+	delivered chan *Message
+}
+
+func newFlakyTransport(failures int) *flakyTransport {
+	return &flakyTransport{failures: failures, delivered: make(chan *Message, 10)}
+}
+
+func (transport *flakyTransport) Send(_ context.Context, message *Message) error {
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+	transport.attempts++
+	if transport.attempts <= transport.failures {
+		return errors.New("relay unavailable")
+	}
+	transport.delivered <- message
+	return nil
+}
+
+func (transport *flakyTransport) Close() {}
+
+func (transport *flakyTransport) Attempts() int {
+	transport.mutex.Lock()
+	defer transport.mutex.Unlock()
+	return transport.attempts
+}
+
+func TestOutboxDeliversAsynchronously(t *testing.T) {
+	next := newFlakyTransport(0)
+	outbox := newTestOutbox(t, t.TempDir(), next, nil)
+	defer outbox.Close()
+
+	require.Nil(t, outbox.Send(context.Background(), newTestMessage()))
+	assertDelivered(t, next)
+	assert.Eventually(t, func() bool { return len(listItems(t, outbox.pendingPath)) == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestOutboxRetriesWithBackoff(t *testing.T) {
+	next := newFlakyTransport(2)
+	outbox := newTestOutbox(t, t.TempDir(), next, nil)
+	defer outbox.Close()
+
+	require.Nil(t, outbox.Send(context.Background(), newTestMessage()))
+	assertDelivered(t, next)
+	assert.Equal(t, 3, next.Attempts())
+}
+
+func TestOutboxRetryDelay(t *testing.T) {
+	outbox := &Outbox{retryBackoff: time.Second, maxRetryBackoff: time.Hour}
+	for attempts, expected := range map[int]time.Duration{
+		1:    time.Second,
+		3:    4 * time.Second,
+		12:   2048 * time.Second,
+		13:   time.Hour,
+		100:  time.Hour,
+		1000: time.Hour,
+	} {
+		assert.Equal(t, expected, outbox.retryDelay(attempts), "Unexpected delay after %d attempts", attempts)
+	}
+}
+
+func TestOutboxMovesToDeadLettersAfterMaxAttempts(t *testing.T) {
+	next := newFlakyTransport(10)
+	outbox := newTestOutbox(t, t.TempDir(), next, map[string]string{"OUTBOX_MAX_ATTEMPTS": "2"})
+	defer outbox.Close()
+
+	require.Nil(t, outbox.Send(context.Background(), newTestMessage()))
+	assert.Eventually(t, func() bool { return len(listItems(t, outbox.deadLetterPath)) == 1 }, time.Second, 10*time.Millisecond)
+	assert.Empty(t, listItems(t, outbox.pendingPath))
+	assert.Equal(t, 2, next.Attempts())
+
+	item, err := readItem(listItems(t, outbox.deadLetterPath)[0])
+	require.Nil(t, err, "Failed to read dead letter: %s\n", err)
+	assert.Equal(t, 2, item.Attempts)
+	assert.Equal(t, "relay unavailable", item.LastError)
+	assert.Equal(t, newTestMessage(), item.Message)
+}
+
+func TestOutboxKeepsUndeliveredItemsAcrossRestarts(t *testing.T) {
+	directory := t.TempDir()
+	outbox := newTestOutbox(t, directory, newFlakyTransport(10), map[string]string{"OUTBOX_RETRY_BACKOFF": "60000"})
+	require.Nil(t, outbox.Send(context.Background(), newTestMessage()))
+	assert.Eventually(t, func() bool {
+		item, err := readItem(listItems(t, outbox.pendingPath)[0])
+		return err == nil && item.Attempts == 1
+	}, time.Second, 10*time.Millisecond)
+	outbox.Close()
+	assert.Len(t, listItems(t, outbox.pendingPath), 1)
+
+	next := newFlakyTransport(0)
+	outbox = newTestOutbox(t, directory, next, map[string]string{"OUTBOX_RETRY_BACKOFF": "1"})
+	defer outbox.Close()
+	// The backoff recorded by the previous run still applies
+	select {
+	case <-next.delivered:
+		t.Fatal("Item was retried before its scheduled attempt")
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.Len(t, listItems(t, outbox.pendingPath), 1)
+}
+
+func TestOutboxRecoversItemsAfterRestart(t *testing.T) {
+	directory := t.TempDir()
+	stuck := newFlakyTransport(0)
+	outbox := newTestOutbox(t, directory, stuck, map[string]string{"OUTBOX_POLL_INTERVAL": "60000"})
+	outbox.stopWorker()
+	<-outbox.workerExited
+	require.Nil(t, outbox.Send(context.Background(), newTestMessage()))
+
+	next := newFlakyTransport(0)
+	restarted := newTestOutbox(t, directory, next, nil)
+	defer restarted.Close()
+	assertDelivered(t, next)
+}
+
+func TestOutboxFlushesOnClose(t *testing.T) {
+	next := newFlakyTransport(0)
+	outbox := newTestOutbox(t, t.TempDir(), next, map[string]string{"OUTBOX_POLL_INTERVAL": "60000"})
+	outbox.stopWorker()
+	<-outbox.workerExited
+	require.Nil(t, outbox.Send(context.Background(), newTestMessage()))
+
+	outbox.Close()
+	assertDelivered(t, next)
+	assert.Empty(t, listItems(t, outbox.pendingPath))
+}
+
+func TestOutboxIsQueued(t *testing.T) {
+	outbox := newTestOutbox(t, t.TempDir(), newFlakyTransport(0), nil)
+	defer outbox.Close()
+
+	assert.True(t, IsQueued(outbox))
+	assert.False(t, IsQueued(NewLog()))
+}
+
+func TestNewWrapsTransportInOutbox(t *testing.T) {
+	mailTransport, err := New(context.Background(), &sync.WaitGroup{}, mockGetEnv(map[string]string{
+		"MAIL_TRANSPORT":   "log",
+		"OUTBOX_DIRECTORY": t.TempDir(),
+	}))
+	require.Nil(t, err, "Failed to build mail transport: %s\n", err)
+	defer mailTransport.Close()
+	assert.IsType(t, &Outbox{}, mailTransport)
+}
+
+func newTestOutbox(t *testing.T, directory string, next Transport, env map[string]string) *Outbox {
+	outboxEnv := map[string]string{
+		"OUTBOX_DIRECTORY":     directory,
+		"OUTBOX_RETRY_BACKOFF": "1",
+		"OUTBOX_POLL_INTERVAL": "5",
+	}
+	for key, value := range env {
+		outboxEnv[key] = value
+	}
+	outbox, err := NewOutbox(next, mockGetEnv(outboxEnv))
+	require.Nil(t, err, "Failed to create outbox: %s\n", err)
+	return outbox
+}
+
+func assertDelivered(t *testing.T, transport *flakyTransport) {
+	select {
+	case message := <-transport.delivered:
+		assert.Equal(t, newTestMessage(), message)
+	case <-time.After(time.Second):
+		t.Fatal("Email was not delivered")
+	}
+}
+
+func listItems(t *testing.T, path string) []string {
+	itemPaths, err := filepath.Glob(filepath.Join(path, "*.json"))
+	require.Nil(t, err, "Failed to list outbox items: %s\n", err)
+	return itemPaths
+}
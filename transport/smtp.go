@@ -0,0 +1,44 @@
+package transport
+
+import (
+	"context"
+	"log"
+
+	"portfolio-back/smtpclient"
+)
+
+// Smtp submits emails to an SMTP server, through a pool of authenticated sessions.
+type Smtp struct {
+	pool *smtpclient.Pool
+}
+
+func NewSmtp(getEnv func(string) string) (*Smtp, error) {
+	config, err := smtpclient.LoadConfig(getEnv)
+	if err != nil {
+		return nil, err
+	}
+	return &Smtp{pool: smtpclient.NewPool(config)}, nil
+}
+
+// Send retries once with a fresh session if the pooled one turns out to be dead.
+func (transport *Smtp) Send(ctx context.Context, message *Message) (err error) {
+	data := message.Bytes()
+	for attempt := 1; attempt <= 2; attempt++ {
+		var session *smtpclient.Session
+		session, err = transport.pool.Get(ctx)
+		if err != nil {
+			return
+		}
+		err = session.Send(ctx, message.From, message.To, data)
+		transport.pool.Release(session, err)
+		if !smtpclient.IsConnectionError(err) || ctx.Err() != nil {
+			return
+		}
+		log.Printf("[WARN] SMTP connection is dead: %s\n", err)
+	}
+	return
+}
+
+func (transport *Smtp) Close() {
+	transport.pool.Close()
+}
@@ -0,0 +1,70 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Transport delivers outgoing emails.
+type Transport interface {
+	Send(ctx context.Context, message *Message) error
+	// Close releases the resources held by the transport, once the app shuts down.
+	Close()
+}
+
+// Queuing is implemented by the transports which only queue emails on Send, and deliver them later.
+type Queuing interface {
+	Queued() bool
+}
+
+// IsQueued reports whether the emails sent through the transport are queued rather than delivered right away.
+func IsQueued(transport Transport) bool {
+	queuing, isQueuing := transport.(Queuing)
+	return isQueuing && queuing.Queued()
+}
+
+// New builds the transport selected by MAIL_TRANSPORT, behind an outbox if OUTBOX_DIRECTORY is set.
+// The transport is closed when the app context is done.
+func New(
+	appContext context.Context,
+	shutdownWaitGroup *sync.WaitGroup,
+	getEnv func(string) string,
+) (Transport, error) {
+	transport, err := newTransport(getEnv("MAIL_TRANSPORT"), getEnv)
+	if err != nil {
+		return nil, err
+	}
+	if getEnv("OUTBOX_DIRECTORY") != "" {
+		transport, err = NewOutbox(transport, getEnv)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	shutdownWaitGroup.Add(1)
+	go func() {
+		<-appContext.Done()
+		transport.Close()
+		shutdownWaitGroup.Done()
+	}()
+	return transport, nil
+}
+
+func newTransport(name string, getEnv func(string) string) (Transport, error) {
+	switch name {
+	case "", "smtp":
+		if getEnv("SMTP_RELAYS") != "" {
+			return NewFailover(getEnv)
+		}
+		return NewSmtp(getEnv)
+	case "file":
+		return NewFile(getEnv)
+	case "log":
+		return NewLog(), nil
+	case "http":
+		return NewHttp(getEnv)
+	default:
+		return nil, fmt.Errorf("unknown mail transport %q", name)
+	}
+}
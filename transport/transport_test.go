@@ -0,0 +1,64 @@
+package transport
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sourceEmailAddress = "source@test.com"
+const targetEmailAddress = "target@test.com"
+
+func TestNewSelectsTransport(t *testing.T) {
+	for name, expectedTransport := range map[string]Transport{
+		"":     &Smtp{},
+		"smtp": &Smtp{},
+		"file": &File{},
+		"log":  &Log{},
+		"http": &Http{},
+	} {
+		mailTransport, err := newTransport(name, mockGetEnv(map[string]string{
+			"MAIL_FILE_DIRECTORY": t.TempDir(),
+			"MAIL_HTTP_API_URL":   "https://mail.test.com/emails",
+		}))
+		require.Nil(t, err, "Failed to build %q mail transport: %s\n", name, err)
+		assert.IsType(t, expectedTransport, mailTransport)
+		mailTransport.Close()
+	}
+}
+
+func TestNewFailsOnUnknownTransport(t *testing.T) {
+	_, err := New(context.Background(), &sync.WaitGroup{}, mockGetEnv(map[string]string{"MAIL_TRANSPORT": "pigeon"}))
+	assert.NotNil(t, err)
+}
+
+func TestNewClosesTransportOnShutdown(t *testing.T) {
+	appContext, triggerShutdown := context.WithCancel(context.Background())
+	shutdownWaitGroup := &sync.WaitGroup{}
+	_, err := New(appContext, shutdownWaitGroup, mockGetEnv(map[string]string{"MAIL_TRANSPORT": "log"}))
+	require.Nil(t, err, "Failed to build mail transport: %s\n", err)
+
+	triggerShutdown()
+	shutdownWaitGroup.Wait()
+}
+
+func newTestMessage() *Message {
+	return &Message{
+		Id:      "0123456789abcdef@test.com",
+		Date:    time.Date(2024, time.June, 1, 12, 0, 0, 0, time.UTC),
+		From:    sourceEmailAddress,
+		To:      []string{targetEmailAddress},
+		Subject: "Test subject",
+		Text:    "Test body",
+	}
+}
+
+func mockGetEnv(values map[string]string) func(string) string {
+	return func(key string) string {
+		return values[key]
+	}
+}